@@ -47,6 +47,12 @@ type args struct {
 	SearchWA    bool   `arg:"-s" help:"search without auth"`
 	MaxSize     string `arg:"-m" help:"max allowed stream size (in Bytes)"`
 	TGToken     string `arg:"-T" help:"telegram bot token"`
+	Backup      string `help:"write backup archive of settings, torrents, viewed and users to file and exit"`
+	Restore     string `help:"restore backup archive from file and exit, server must be stopped"`
+	RestoreMode string `help:"restore strategy for existing data: skip, merge or overwrite (default merge)"`
+	SQLite      string `help:"comma separated DB routes stored in SQLite config.sqlite: Settings, Viewed, MediaInfo, Torrents, Users or all"`
+	Migrations  bool   `help:"show DB migrations, pending ones are run dry, and exit"`
+	Rollback    string `help:"roll back DB migrations to version before downgrade and exit, with --rdb rollback is run dry"`
 }
 
 func (args) Version() string {
@@ -71,6 +77,9 @@ func main() {
 	settings.Path = params.Path
 	settings.StreamLinksPath = params.StreamLinks
 	settings.HttpAuth = params.HttpAuth
+	if params.SQLite != "" {
+		settings.SQLiteRoutes = strings.Split(params.SQLite, ",")
+	}
 	log.Init(params.LogPath, params.WebLogPath)
 	fmt.Println("=========== START ===========")
 	fmt.Println("TorrServer", version.Version+",", runtime.Version()+",", "CPU Num:", runtime.NumCPU())
@@ -82,6 +91,13 @@ func main() {
 	}
 	docs.SwaggerInfo.Version = version.Version
 
+	if params.Backup != "" || params.Restore != "" {
+		os.Exit(backupRestore())
+	}
+	if params.Migrations || params.Rollback != "" {
+		os.Exit(migrations())
+	}
+
 	dnsResolve()
 	Preconfig(params.DontKill)
 
@@ -126,6 +142,60 @@ func main() {
 	os.Exit(0)
 }
 
+// backupRestore writes or restores backup archive, returns exit code
+func backupRestore() int {
+	settings.InitSets(params.RDB, params.SearchWA)
+	defer settings.CloseDB()
+	if params.Backup != "" {
+		if err := settings.BackupFile(params.Backup); err != nil {
+			log.TLogln("Error backup:", err)
+			return 1
+		}
+		log.TLogln("Backup saved to", params.Backup)
+	}
+	if params.Restore != "" {
+		res, err := settings.RestoreFile(params.Restore, params.RestoreMode)
+		if err != nil {
+			log.TLogln("Error restore:", err)
+			return 1
+		}
+		for name, stat := range res.Sections {
+			log.TLogln(fmt.Sprintf("Restored %s: added %d, updated %d, skipped %d, removed %d", name, stat.Added, stat.Updated, stat.Skipped, stat.Removed))
+		}
+	}
+	return 0
+}
+
+// migrations shows or rolls back DB migrations, returns exit code
+func migrations() int {
+	if params.Rollback != "" {
+		version, err := strconv.Atoi(params.Rollback)
+		if err != nil || version < 0 {
+			log.TLogln("Wrong rollback version:", params.Rollback)
+			return 1
+		}
+		settings.InitSets(params.RDB, params.SearchWA)
+		defer settings.CloseDB()
+		if err = settings.RollbackMigrations(version); err != nil {
+			log.TLogln("Error rollback:", err)
+			return 1
+		}
+	} else {
+		// read-only mode runs pending migrations dry
+		settings.InitSets(true, params.SearchWA)
+		defer settings.CloseDB()
+	}
+	for _, st := range settings.ListMigrations() {
+		applied := "pending"
+		if st.Applied > 0 {
+			applied = "applied " + time.Unix(st.Applied, 0).Format(time.RFC3339)
+		}
+		fmt.Printf("%d %s: %s\n", st.Version, st.Name, applied)
+	}
+	fmt.Println("DB schema version", settings.SchemaVersion(), "of", settings.LatestSchemaVersion())
+	return 0
+}
+
 func dnsResolve() {
 	addrs, err := net.LookupHost("www.google.com")
 	if len(addrs) == 0 {
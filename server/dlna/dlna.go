@@ -126,7 +126,7 @@ func onBrowse(path, rootObjectPath, host, userAgent string) (ret []interface{},
 	} else if isHashPath(path) {
 		ret = getTorrent(path, host)
 		return
-	} else if filepath.Base(path) == "LD" {
+	} else if filepath.Base(path) == "LD" || seasonOfPath(path) > 0 {
 		ret = loadTorrent(path, host)
 	}
 	return
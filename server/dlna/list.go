@@ -2,6 +2,7 @@ package dlna
 
 import (
 	"fmt"
+	"html"
 	"net/url"
 	"path/filepath"
 	"sort"
@@ -15,8 +16,11 @@ import (
 	"server/log"
 	mt "server/mimetype"
 	"server/settings"
+	"server/subs"
+	"server/thumbs"
 	"server/torr"
 	"server/torr/state"
+	"server/utils"
 )
 
 func getRoot() (ret []interface{}) {
@@ -164,6 +168,19 @@ func getTorrentMeta(path, host string) (ret interface{}) {
 		}
 		meta := upnpav.Container{Object: obj, ChildCount: 1}
 		return meta
+	} else if season := seasonOfPath(path); season > 0 {
+		parent := url.PathEscape(filepath.Dir(path))
+		// season folder object meta
+		obj := upnpav.Object{
+			ID:         parent + "%2F" + url.PathEscape(seasonTitle(season)),
+			ParentID:   parent,
+			Restricted: 1,
+			Title:      seasonTitle(season),
+			Class:      "object.container.storageFolder",
+			Date:       upnpav.Timestamp{Time: time.Now()},
+		}
+		meta := upnpav.Container{Object: obj, ChildCount: 1}
+		return meta
 	} else if filepath.Base(path) == "LD" {
 		parent := url.PathEscape(filepath.Dir(path))
 		// LD object meta
@@ -224,9 +241,36 @@ func loadTorrent(path, host string) (ret []interface{}) {
 		}
 	}
 	parent := "%2F" + tor.TorrentSpec.InfoHash.HexString()
-	files := tor.Status().FileStats
+	// all files are used to find subtitles of video in other folders of torrent
+	stats := tor.Status().FileStats
+	files := utils.SortEpisodes(stats)
+	// series with several seasons are listed in season folders
+	if season := seasonOfPath(path); season > 0 {
+		parent += "%2F" + url.PathEscape(seasonTitle(season))
+		files = utils.SeasonFiles(files, season)
+	} else if seasons := utils.Seasons(files); len(seasons) > 1 {
+		for _, season := range seasons {
+			obj := upnpav.Object{
+				ID:         parent + "%2F" + url.PathEscape(seasonTitle(season)),
+				ParentID:   parent,
+				Restricted: 1,
+				Title:      seasonTitle(season),
+				Class:      "object.container.storageFolder",
+				Date:       upnpav.Timestamp{Time: time.Now()},
+			}
+			cnt := upnpav.Container{Object: obj, ChildCount: len(utils.SeasonFiles(files, season))}
+			ret = append(ret, cnt)
+		}
+		var other []*state.TorrentFileStat
+		for _, f := range files {
+			if f.Episode == nil || f.Episode.Episode == 0 || f.Episode.Season == 0 {
+				other = append(other, f)
+			}
+		}
+		files = other
+	}
 	for _, f := range files {
-		obj := getObjFromTorrent(path, parent, host, tor, f)
+		obj := getObjFromTorrent(path, parent, host, tor, stats, f)
 		if obj != nil {
 			ret = append(ret, obj)
 		}
@@ -253,7 +297,7 @@ func getLink(host, path string) string {
 	// }
 }
 
-func getObjFromTorrent(path, parent, host string, torr *torr.Torrent, file *state.TorrentFileStat) (ret interface{}) {
+func getObjFromTorrent(path, parent, host string, torr *torr.Torrent, stats []*state.TorrentFileStat, file *state.TorrentFileStat) (ret interface{}) {
 	mime, err := mt.MimeTypeByPath(file.Path)
 	if err != nil {
 		if settings.BTsets.EnableDebug {
@@ -262,7 +306,7 @@ func getObjFromTorrent(path, parent, host string, torr *torr.Torrent, file *stat
 		return
 	}
 	// TODO: handle subtitles for media
-	if !mime.IsMedia() {
+	if !mime.IsMedia() || file.Priority == settings.FilePrioritySkip {
 		return
 	}
 	if settings.BTsets.EnableDebug {
@@ -278,11 +322,21 @@ func getObjFromTorrent(path, parent, host string, torr *torr.Torrent, file *stat
 		Date:       upnpav.Timestamp{Time: time.Now()},
 	}
 
+	// only thumbnail created before, renderers request art of every item of list,
+	// missing thumbnail is made in background for next listings
+	if mime.IsVideo() {
+		if thumbs.Exists(torr.TorrentSpec.InfoHash.HexString(), file.Id) {
+			obj.AlbumArtURI = getLink(host, thumbs.Path(torr.TorrentSpec.InfoHash.HexString(), file.Id))
+		} else {
+			thumbs.Queue(torr.TorrentSpec.InfoHash.HexString(), file.Id)
+		}
+	}
+
 	item := upnpav.Item{
 		Object: obj,
 		Res:    make([]upnpav.Resource, 0, 1),
 	}
-	pathPlay := "stream/" + url.PathEscape(file.Path) + "?link=" + torr.TorrentSpec.InfoHash.HexString() + "&play&index=" + strconv.Itoa(file.Id)
+	pathPlay := "stream/" + url.PathEscape(file.Path) + "?link=" + torr.TorrentSpec.InfoHash.HexString() + "&play&index=" + strconv.Itoa(file.Id) + settings.StreamLinkToken(torr.TorrentSpec.InfoHash.HexString(), file.Id)
 	item.Res = append(item.Res, upnpav.Resource{
 		URL: getLink(host, pathPlay),
 		ProtocolInfo: fmt.Sprintf("http-get:*:%s:%s", mime, dlna.ContentFeatures{
@@ -291,5 +345,23 @@ func getObjFromTorrent(path, parent, host string, torr *torr.Torrent, file *stat
 		}.String()),
 		Size: uint64(file.Length),
 	})
+	// subtitles tracks converted to srt, first track is caption for Samsung and compatible renderers
+	for i, t := range subs.List(torr.TorrentSpec.InfoHash.HexString(), stats, file.Id, false) {
+		link := getLink(host, subs.Path(torr.TorrentSpec.InfoHash.HexString(), file.Id, t.Id, "srt"))
+		item.Res = append(item.Res, upnpav.Resource{
+			URL:          link,
+			ProtocolInfo: "http-get:*:text/srt:*",
+		})
+		if i == 0 {
+			item.InnerXML += `<sec:CaptionInfoEx xmlns:sec="http://www.sec.co.kr/" sec:type="srt">` + html.EscapeString(link) + `</sec:CaptionInfoEx>`
+		}
+	}
+	// resume bookmark for Samsung and compatible renderers
+	if pos := settings.GetPosition(torr.TorrentSpec.InfoHash.HexString(), file.Id); pos != nil && pos.Seconds > 0 {
+		item.InnerXML += fmt.Sprintf(`<sec:dcmInfo xmlns:sec="http://www.sec.co.kr/">BM=%d</sec:dcmInfo>`, int64(pos.Seconds))
+		if pos.Duration > 0 {
+			item.Res[0].Duration = formatDuration(pos.Duration)
+		}
+	}
 	return item
 }
@@ -1,7 +1,10 @@
 package dlna
 
 import (
+	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 func isHashPath(path string) bool {
@@ -17,3 +20,23 @@ func isHashPath(path string) bool {
 	}
 	return false
 }
+
+func seasonTitle(season int) string {
+	return "Season " + strconv.Itoa(season)
+}
+
+// seasonOfPath returns season of season folder path of torrent, /<hash>/Season 2
+func seasonOfPath(path string) int {
+	base := filepath.Base(path)
+	if !strings.HasPrefix(base, "Season ") || !isHashPath(filepath.Dir(path)) {
+		return 0
+	}
+	season, _ := strconv.Atoi(strings.TrimPrefix(base, "Season "))
+	return season
+}
+
+// formatDuration formats seconds as DIDL-Lite res duration H+:MM:SS.FFF
+func formatDuration(seconds float64) string {
+	ms := int64(seconds * 1000)
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,36 @@
+package ffprobe
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+var ffmpegFile = "ffmpeg"
+
+func init() {
+	path, err := exec.LookPath("ffmpeg")
+	if err == nil {
+		ffmpegFile = path
+	} else {
+		// working dir
+		if _, err := os.Stat("ffmpeg"); os.IsNotExist(err) {
+			ffmpegFile = filepath.Dir(os.Args[0]) + "/ffmpeg"
+		} else {
+			ffmpegFile = "./ffmpeg"
+		}
+	}
+}
+
+// FFmpegExists reports if ffmpeg binary is found next to ffprobe
+func FFmpegExists() bool {
+	_, err := os.Stat(ffmpegFile)
+	return !os.IsNotExist(err)
+}
+
+// FFmpeg returns ffmpeg command, process is killed on cancel of ctx
+func FFmpeg(ctx context.Context, args ...string) *exec.Cmd {
+	args = append([]string{"-hide_banner", "-loglevel", "error", "-nostdin"}, args...)
+	return exec.CommandContext(ctx, ffmpegFile, args...)
+}
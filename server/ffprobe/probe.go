@@ -0,0 +1,56 @@
+package ffprobe
+
+import (
+	"encoding/json"
+	"os/exec"
+)
+
+// Probe is ffprobe output of format, streams and chapters of media file
+type Probe struct {
+	Format   *ProbeFormat    `json:"format"`
+	Streams  []*ProbeStream  `json:"streams"`
+	Chapters []*ProbeChapter `json:"chapters"`
+}
+
+type ProbeFormat struct {
+	FormatName string `json:"format_name"`
+	Duration   string `json:"duration"`
+	BitRate    string `json:"bit_rate"`
+}
+
+type ProbeStream struct {
+	Index         int               `json:"index"`
+	CodecName     string            `json:"codec_name"`
+	CodecType     string            `json:"codec_type"`
+	Profile       string            `json:"profile"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	AvgFrameRate  string            `json:"avg_frame_rate"`
+	ColorTransfer string            `json:"color_transfer"`
+	Channels      int               `json:"channels"`
+	ChannelLayout string            `json:"channel_layout"`
+	Disposition   map[string]int    `json:"disposition"`
+	Tags          map[string]string `json:"tags"`
+	SideDataList  []map[string]any  `json:"side_data_list"`
+}
+
+type ProbeChapter struct {
+	StartTime string            `json:"start_time"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// ProbeLink runs ffprobe for link and returns its format, streams and chapters
+func ProbeLink(link string) (*Probe, error) {
+	cmd := exec.CommandContext(getCtx(), binFile, "-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", "-show_chapters", link)
+	buf, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	probe := new(Probe)
+	if err = json.Unmarshal(buf, probe); err != nil {
+		return nil, err
+	}
+	return probe, nil
+}
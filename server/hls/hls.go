@@ -0,0 +1,259 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"server/ffprobe"
+	"server/log"
+)
+
+const (
+	IndexName = "index.m3u8"
+	// SegmentTime is duration of segment in seconds
+	SegmentTime    = 6
+	idleTimeout    = 5 * time.Minute
+	segmentTimeout = 2 * time.Minute
+	pollTime       = 200 * time.Millisecond
+)
+
+// CopyCodecs remuxes first video and audio tracks without transcoding
+var CopyCodecs = []string{"-map", "0:v:0?", "-map", "0:a:0?", "-c", "copy", "-sn"}
+
+// ErrBusy is returned by Start when acquire doesn't allow to start ffmpeg
+var ErrBusy = errors.New("too many transcodes")
+
+var segmentName = regexp.MustCompile(`^seg(\d{5})\.ts$`)
+
+// session is ffmpeg writing playlist and segments of file to session dir
+type session struct {
+	dir     string
+	cancel  context.CancelFunc
+	done    chan struct{} // closed when ffmpeg exits
+	err     error         // error of ffmpeg, set before done is closed
+	release func()
+
+	accessed atomic.Int64
+}
+
+var (
+	sessions  = make(map[string]*session)
+	muSession sync.Mutex
+	rootDir   = filepath.Join(os.TempDir(), "torrserver-hls")
+	cleaner   sync.Once
+)
+
+// IsSegment reports if name is name of segment file
+func IsSegment(name string) bool {
+	return segmentName.MatchString(name)
+}
+
+func sessionDir(key string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_", ".", "_").Replace(key)
+	return filepath.Join(rootDir, name)
+}
+
+// Start starts ffmpeg of session of key if it isn't running. One ffmpeg reads link from start
+// and writes segments and playlist, codecs are ffmpeg output options, CopyCodecs for remux.
+// acquire is called before start of ffmpeg, release after its exit, both may be nil.
+func Start(key, link string, codecs []string, acquire func() bool, release func()) error {
+	cleaner.Do(func() {
+		os.RemoveAll(rootDir)
+		go clean()
+	})
+
+	muSession.Lock()
+	defer muSession.Unlock()
+	if ss, ok := sessions[key]; ok {
+		ss.accessed.Store(time.Now().Unix())
+		return nil
+	}
+	if !ffprobe.FFmpegExists() {
+		return errors.New("ffmpeg not found")
+	}
+	if acquire != nil && !acquire() {
+		return ErrBusy
+	}
+	dir := sessionDir(key)
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		if release != nil {
+			release()
+		}
+		return err
+	}
+
+	args := []string{"-i", link}
+	args = append(args, codecs...)
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(SegmentTime),
+		"-hls_list_size", "0",
+		"-hls_playlist_type", "event",
+		"-hls_flags", "temp_file",
+		"-hls_segment_filename", filepath.Join(dir, "seg%05d.ts"),
+		filepath.Join(dir, IndexName),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := ffprobe.FFmpeg(ctx, args...)
+	cmd.WaitDelay = 5 * time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		cancel()
+		if release != nil {
+			release()
+		}
+		return err
+	}
+
+	ss := &session{dir: dir, cancel: cancel, done: make(chan struct{}), release: release}
+	ss.accessed.Store(time.Now().Unix())
+	sessions[key] = ss
+	log.TLogln("Start hls:", key)
+	go func() {
+		err := cmd.Wait()
+		if err != nil && ctx.Err() == nil {
+			log.TLogln("Error hls:", key, err, strings.TrimSpace(stderr.String()))
+			ss.err = err
+		}
+		if ss.release != nil {
+			ss.release()
+		}
+		close(ss.done)
+		if ss.err != nil {
+			// failed session is started again on next request
+			muSession.Lock()
+			if sessions[key] == ss {
+				delete(sessions, key)
+			}
+			muSession.Unlock()
+		}
+	}()
+	return nil
+}
+
+func getSession(key string) *session {
+	muSession.Lock()
+	defer muSession.Unlock()
+	ss, ok := sessions[key]
+	if ok {
+		ss.accessed.Store(time.Now().Unix())
+	}
+	return ss
+}
+
+// wait waits for file of session written by ffmpeg, ffmpeg renames written files
+func (ss *session) wait(ctx context.Context, name string) (string, error) {
+	path := filepath.Join(ss.dir, name)
+	timeout := time.NewTimer(segmentTimeout)
+	defer timeout.Stop()
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		select {
+		case <-ss.done:
+			// file may be written on exit
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+			if ss.err != nil {
+				return "", ss.err
+			}
+			return "", os.ErrNotExist
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timeout.C:
+			return "", os.ErrDeadlineExceeded
+		case <-time.After(pollTime):
+		}
+	}
+}
+
+// Playlist returns playlist written by ffmpeg of started session. Playlist is event
+// playlist growing with written segments and ended when ffmpeg reaches end of file,
+// players start it from beginning.
+func Playlist(ctx context.Context, key string) ([]byte, error) {
+	ss := getSession(key)
+	if ss == nil {
+		return nil, os.ErrNotExist
+	}
+	path, err := ss.wait(ctx, IndexName)
+	if err != nil {
+		return nil, err
+	}
+	list, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Replace(list, []byte("#EXTM3U\n"), []byte("#EXTM3U\n#EXT-X-START:TIME-OFFSET=0\n"), 1), nil
+}
+
+// Segment returns path of segment file of started session, waits while ffmpeg writes it
+func Segment(ctx context.Context, key, name string) (string, error) {
+	if !IsSegment(name) {
+		return "", errors.New("wrong segment name")
+	}
+	ss := getSession(key)
+	if ss == nil {
+		return "", os.ErrNotExist
+	}
+	return ss.wait(ctx, name)
+}
+
+// Stop stops ffmpeg and removes segments of session
+func Stop(key string) {
+	muSession.Lock()
+	ss, ok := sessions[key]
+	delete(sessions, key)
+	muSession.Unlock()
+	if !ok {
+		return
+	}
+	ss.cancel()
+	<-ss.done
+	os.RemoveAll(ss.dir)
+	log.TLogln("Stop hls:", key)
+}
+
+// StopHash stops all sessions of torrent
+func StopHash(hash string) {
+	muSession.Lock()
+	keys := make([]string, 0)
+	for key := range sessions {
+		if strings.HasPrefix(key, strings.ToLower(hash)+"/") {
+			keys = append(keys, key)
+		}
+	}
+	muSession.Unlock()
+	for _, key := range keys {
+		Stop(key)
+	}
+}
+
+func clean() {
+	for {
+		time.Sleep(time.Minute)
+		muSession.Lock()
+		keys := make([]string, 0)
+		for key, ss := range sessions {
+			if time.Since(time.Unix(ss.accessed.Load(), 0)) > idleTimeout {
+				keys = append(keys, key)
+			}
+		}
+		muSession.Unlock()
+		for _, key := range keys {
+			Stop(key)
+		}
+	}
+}
@@ -47,7 +47,8 @@ func init() {
 		{"video/x-quicktime", ".qt,.mov"},
 		{"text/srt", ".srt"},
 		{"text/smi", ".smi"},
-		{"text/ssa", ".ssa"},
+		{"text/ssa", ".ssa,.ass"},
+		{"text/vtt", ".vtt"},
 	} {
 		for _, ext := range strings.Split(t.extensions, ",") {
 			err := mime.AddExtensionType(ext, t.mimeType)
@@ -86,7 +87,7 @@ func (mt mimeType) IsImage() bool {
 
 // IsSub returns true for subtitles MIME-types
 func (mt mimeType) IsSub() bool {
-	return strings.HasPrefix(string(mt), "text/srt") || strings.HasPrefix(string(mt), "text/smi") || strings.HasPrefix(string(mt), "text/ssa")
+	return strings.HasPrefix(string(mt), "text/srt") || strings.HasPrefix(string(mt), "text/smi") || strings.HasPrefix(string(mt), "text/ssa") || strings.HasPrefix(string(mt), "text/vtt")
 }
 
 // Returns the group "type", the part before the '/'.
@@ -0,0 +1,322 @@
+package settings
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"server/log"
+	"server/version"
+)
+
+// BackupVersion is version of backup archive format, archives of newer versions are not restored
+const BackupVersion = 1
+
+// Restore strategies of entries existing in DB
+const (
+	RestoreSkip      = "skip"      // keep existing entries, add only missing ones
+	RestoreMerge     = "merge"     // replace existing entries by backup ones, viewed files are joined
+	RestoreOverwrite = "overwrite" // replace whole sections, entries missing in backup are removed
+)
+
+// backupSections are DB xpaths saved in backup, MediaInfo isn't saved as it is probed again
+var backupSections = []string{"Settings", "Torrents", "Viewed", "Users"}
+
+const (
+	backupManifest = "backup.json"
+	backupAccs     = "accs.db"
+)
+
+type BackupManifest struct {
+	Version  int      `json:"version"`
+	App      string   `json:"app"`
+	Created  int64    `json:"created"`
+	Schema   int      `json:"schema"` // version of DB migrations
+	Sections []string `json:"sections"`
+}
+
+type BackupStat struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+	Removed int `json:"removed"`
+}
+
+type RestoreResult struct {
+	Sections map[string]*BackupStat `json:"sections"`
+	// Sets are restored settings, they must be applied by caller with SetBTSets
+	// or torr.SetSettings, nil if settings are not restored
+	Sets *BTSets `json:"-"`
+	// UpdatedTorrents and RemovedTorrents are hashes of torrents changed in DB,
+	// running server must reload or remove them from BT client
+	UpdatedTorrents []string `json:"-"`
+	RemovedTorrents []string `json:"-"`
+}
+
+func backupFileName(xpath string) string {
+	return strings.ToLower(xpath) + ".json"
+}
+
+// Backup writes zip archive with settings, torrents, viewed files and users
+func Backup(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	manifest := &BackupManifest{
+		Version:  BackupVersion,
+		App:      "TorrServer " + version.Version,
+		Created:  time.Now().Unix(),
+		Schema:   SchemaVersion(),
+		Sections: backupSections,
+	}
+	if err := writeZipJson(zw, backupManifest, manifest); err != nil {
+		return err
+	}
+	for _, xpath := range backupSections {
+		entries := make(map[string]json.RawMessage)
+		for _, name := range tdb.List(xpath) {
+			buf := tdb.Get(xpath, name)
+			if !json.Valid(buf) {
+				log.TLogln("Skip backup of wrong entry", xpath, name)
+				continue
+			}
+			entries[name] = buf
+		}
+		if err := writeZipJson(zw, backupFileName(xpath), entries); err != nil {
+			return err
+		}
+	}
+	// old plain text users file, users are imported from it while there are no users
+	if buf, err := os.ReadFile(filepath.Join(Path, backupAccs)); err == nil {
+		fw, err := zw.Create(backupAccs)
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeZipJson(zw *zip.Writer, name string, v interface{}) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", " ")
+	return enc.Encode(v)
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Restore restores backup archive to DB with strategy: skip, merge or overwrite.
+// Settings are not saved, they are returned in result to be applied by caller
+func Restore(r io.ReaderAt, size int64, strategy string) (*RestoreResult, error) {
+	if ReadOnly {
+		return nil, errors.New("read-only DB mode")
+	}
+	if strategy == "" {
+		strategy = RestoreMerge
+	}
+	if strategy != RestoreSkip && strategy != RestoreMerge && strategy != RestoreOverwrite {
+		return nil, errors.New("wrong restore strategy: " + strategy)
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	mf, ok := files[backupManifest]
+	if !ok {
+		return nil, errors.New("wrong backup archive, " + backupManifest + " not found")
+	}
+	buf, err := readZipFile(mf)
+	if err != nil {
+		return nil, err
+	}
+	var manifest BackupManifest
+	if err = json.Unmarshal(buf, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version < 1 || manifest.Version > BackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	if manifest.Schema > LatestSchemaVersion() {
+		return nil, fmt.Errorf("backup of newer DB schema %d, server supports %d", manifest.Schema, LatestSchemaVersion())
+	}
+
+	// read all sections before changing DB, so broken archive changes nothing
+	data := make(map[string]map[string]json.RawMessage)
+	for _, xpath := range backupSections {
+		f, ok := files[backupFileName(xpath)]
+		if !ok {
+			continue
+		}
+		buf, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		entries := make(map[string]json.RawMessage)
+		if err = json.Unmarshal(buf, &entries); err != nil {
+			return nil, fmt.Errorf("error read %s: %w", f.Name, err)
+		}
+		data[xpath] = entries
+	}
+
+	res := &RestoreResult{Sections: make(map[string]*BackupStat)}
+	for _, xpath := range backupSections {
+		if entries, ok := data[xpath]; ok {
+			res.Sections[xpath] = restoreSection(xpath, entries, strategy, res)
+		}
+	}
+
+	if f, ok := files[backupAccs]; ok {
+		name := filepath.Join(Path, backupAccs)
+		if _, err := os.Stat(name); err != nil || strategy != RestoreSkip {
+			if buf, err := readZipFile(f); err == nil {
+				if err = os.WriteFile(name, buf, 0o666); err != nil {
+					log.TLogln("Error restore", backupAccs, err)
+				}
+			}
+		}
+	}
+
+	// stream secret could be replaced
+	muStreamSecret.Lock()
+	streamSecret = nil
+	muStreamSecret.Unlock()
+
+	log.TLogln("Restored backup of", manifest.App, "created", time.Unix(manifest.Created, 0).Format(time.RFC3339), "with strategy", strategy)
+	return res, nil
+}
+
+// restoreSection restores entries of xpath, torrents and viewed files are locked
+// as they are changed by read-modify-write
+func restoreSection(xpath string, entries map[string]json.RawMessage, strategy string, res *RestoreResult) *BackupStat {
+	switch xpath {
+	case "Torrents":
+		mu.Lock()
+		defer mu.Unlock()
+	case "Viewed":
+		muViewed.Lock()
+		defer muViewed.Unlock()
+	}
+	stat := new(BackupStat)
+	existing := make(map[string]bool)
+	for _, name := range tdb.List(xpath) {
+		existing[name] = true
+	}
+	for name, value := range entries {
+		if existing[name] && strategy == RestoreSkip {
+			stat.Skipped++
+			continue
+		}
+		if xpath == "Settings" && name == "BitTorr" {
+			var sets *BTSets
+			if err := json.Unmarshal(value, &sets); err != nil || sets == nil {
+				log.TLogln("Error restore settings:", err)
+				stat.Skipped++
+				continue
+			}
+			res.Sets = sets
+		} else {
+			if xpath == "Viewed" && existing[name] && strategy == RestoreMerge {
+				value = mergeViewed(name, value)
+			}
+			tdb.Set(xpath, name, value)
+		}
+		if existing[name] {
+			stat.Updated++
+			if xpath == "Torrents" {
+				res.UpdatedTorrents = append(res.UpdatedTorrents, name)
+			}
+		} else {
+			stat.Added++
+		}
+	}
+	if strategy == RestoreOverwrite {
+		for name := range existing {
+			// current settings are kept if backup has none
+			if _, ok := entries[name]; !ok && !(xpath == "Settings" && name == "BitTorr") {
+				tdb.Rem(xpath, name)
+				stat.Removed++
+				if xpath == "Torrents" {
+					res.RemovedTorrents = append(res.RemovedTorrents, name)
+				}
+			}
+		}
+	}
+	return stat
+}
+
+// mergeViewed joins viewed files of torrent from backup with existing ones,
+// for file viewed in both the latest position is kept, must be called under muViewed
+func mergeViewed(hash string, value json.RawMessage) json.RawMessage {
+	restored := make(map[int]*viewedPos)
+	if err := json.Unmarshal(value, &restored); err != nil {
+		return value
+	}
+	indexes, err := getViewed(hash)
+	if err != nil {
+		return value
+	}
+	for index, pos := range restored {
+		if cur, ok := indexes[index]; ok && cur != nil && pos != nil && cur.Updated > pos.Updated {
+			continue
+		}
+		indexes[index] = pos
+	}
+	buf, err := json.Marshal(indexes)
+	if err != nil {
+		return value
+	}
+	return buf
+}
+
+// RestoreFile restores backup archive from file, used on start by command line flag
+func RestoreFile(name, strategy string) (*RestoreResult, error) {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	res, err := Restore(bytes.NewReader(buf), int64(len(buf)), strategy)
+	if err != nil {
+		return nil, err
+	}
+	if res.Sets != nil {
+		SetBTSets(res.Sets)
+	}
+	return res, nil
+}
+
+// BackupFile writes backup archive to file, used by command line flag
+func BackupFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = Backup(f); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	return f.Close()
+}
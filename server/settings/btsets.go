@@ -22,6 +22,9 @@ type BTSets struct {
 	StreamLinksPath   string
 	RemoveCacheOnDrop bool
 
+	DiskCacheQuota        int64 // in byte, disk cache of all torrents, 0 - no limit
+	DiskCacheQuotaPercent int   // in percent of free space, 0 - no limit
+
 	// Torrent
 	ForceEncrypt             bool
 	RetrackersMode           int  // 0 - don`t add, 1 - add retrackers (def), 2 - remove retrackers 3 - replace retrackers
@@ -48,6 +51,9 @@ type BTSets struct {
 	ConnectionsLimit  int
 	PeersListenPort   int
 
+	// Rate limits schedule, first active schedule overrides DownloadRateLimit and UploadRateLimit
+	RateSchedules []*RateSchedule
+
 	// HTTPS
 	SslPort int
 	SslCert string
@@ -55,6 +61,16 @@ type BTSets struct {
 
 	// Reader
 	ResponsiveMode bool // enable Responsive reader (don't wait pieceComplete)
+
+	// Transcoding
+	TranscodeProfiles []*TranscodeProfile // empty - default profiles
+	TranscodeLimit    int                 // concurrent transcodes, def 2
+
+	// Signed stream links
+	StreamTokenTTL int // in hours, 0 - default 720, negative - links never expire
+
+	// Policies
+	TorrentPolicies map[string]*TorrentPolicy // key is torrent hash or category: movie, tv, music, other
 }
 
 func (v *BTSets) String() string {
@@ -78,6 +94,9 @@ func SetBTSets(sets *BTSets) {
 	if sets.TorrentDisconnectTimeout == 0 {
 		sets.TorrentDisconnectTimeout = 30
 	}
+	if sets.StreamTokenTTL == 0 {
+		sets.StreamTokenTTL = DefaultStreamTokenTTL
+	}
 
 	if sets.ReaderReadAHead < 5 {
 		sets.ReaderReadAHead = 5
@@ -93,6 +112,33 @@ func SetBTSets(sets *BTSets) {
 		sets.PreloadCache = 100
 	}
 
+	if sets.DiskCacheQuota < 0 {
+		sets.DiskCacheQuota = 0
+	}
+	if sets.DiskCacheQuotaPercent < 0 {
+		sets.DiskCacheQuotaPercent = 0
+	}
+	if sets.DiskCacheQuotaPercent > 100 {
+		sets.DiskCacheQuotaPercent = 100
+	}
+
+	policies := make(map[string]*TorrentPolicy, len(sets.TorrentPolicies))
+	for key, p := range sets.TorrentPolicies {
+		if p == nil || strings.TrimSpace(key) == "" {
+			continue
+		}
+		checkPolicy(p)
+		policies[strings.ToLower(strings.TrimSpace(key))] = p
+	}
+	sets.TorrentPolicies = policies
+
+	sets.RateSchedules = checkSchedules(sets.RateSchedules)
+
+	sets.TranscodeProfiles = checkTranscodeProfiles(sets.TranscodeProfiles)
+	if sets.TranscodeLimit <= 0 {
+		sets.TranscodeLimit = 2
+	}
+
 	if sets.TorrentsSavePath == "" {
 		sets.UseDisk = false
 	} else if sets.UseDisk {
@@ -133,6 +179,8 @@ func SetDefaultConfig() {
 	sets.RetrackersMode = 1
 	sets.TorrentDisconnectTimeout = 30
 	sets.ReaderReadAHead = 95 // 95%
+	sets.StreamTokenTTL = DefaultStreamTokenTTL
+	sets.TranscodeLimit = 2
 	BTsets = sets
 	StreamLinksPath = ""
 	if !ReadOnly {
@@ -153,6 +201,10 @@ func loadBTSets() {
 			if BTsets.ReaderReadAHead < 5 {
 				BTsets.ReaderReadAHead = 5
 			}
+			// settings saved before signed links have no TTL
+			if BTsets.StreamTokenTTL == 0 {
+				BTsets.StreamTokenTTL = DefaultStreamTokenTTL
+			}
 			if strings.TrimSpace(StreamLinksPath) == "" {
 				StreamLinksPath = strings.TrimSpace(BTsets.StreamLinksPath)
 			} else {
@@ -1,6 +1,7 @@
 package settings
 
 import (
+	"errors"
 	"path/filepath"
 	"strings"
 	"time"
@@ -18,7 +19,11 @@ type TDB struct {
 func NewTDB() TorrServerDB {
 	db, err := bolt.Open(filepath.Join(Path, "config.db"), 0o666, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
-		log.TLogln(err)
+		if errors.Is(err, bolt.ErrTimeout) {
+			log.TLogln("Error open config.db: DB is locked by other process, stop running server")
+		} else {
+			log.TLogln(err)
+		}
 		return nil
 	}
 
@@ -0,0 +1,41 @@
+package settings
+
+import (
+	"encoding/json"
+
+	"server/log"
+	"server/torr/state"
+)
+
+// ListMediaInfo returns media info of files of torrent probed before, by file index
+func ListMediaInfo(hash string) map[int]*state.MediaInfo {
+	list := make(map[int]*state.MediaInfo)
+	buf := tdb.Get("MediaInfo", hash)
+	if len(buf) == 0 {
+		return list
+	}
+	if err := json.Unmarshal(buf, &list); err != nil {
+		log.TLogln("Error get media info:", err)
+	}
+	return list
+}
+
+// SetMediaInfo saves media info of file of torrent
+func SetMediaInfo(hash string, index int, info *state.MediaInfo) {
+	if ReadOnly {
+		return
+	}
+	list := ListMediaInfo(hash)
+	list[index] = info
+	buf, err := json.Marshal(list)
+	if err != nil {
+		log.TLogln("Error set media info:", err)
+		return
+	}
+	tdb.Set("MediaInfo", hash, buf)
+}
+
+// RemMediaInfo removes media info of files of torrent
+func RemMediaInfo(hash string) {
+	tdb.Rem("MediaInfo", hash)
+}
@@ -1,6 +1,7 @@
 package settings
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -14,6 +15,7 @@ import (
 	"server/web/api/utils"
 
 	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var dbTorrentsName = []byte("Torrents")
@@ -28,15 +30,14 @@ type torrentOldDB struct {
 }
 
 // Migrate from torrserver.db to config.db
-func MigrateTorrents() {
+func migrateTorrents(m *Migrator) error {
 	if _, err := os.Lstat(filepath.Join(Path, "torrserver.db")); os.IsNotExist(err) {
-		return
+		return nil
 	}
 
 	db, err := bolt.Open(filepath.Join(Path, "torrserver.db"), 0o666, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
-		log.TLogln("MigrateTorrents", err)
-		return
+		return fmt.Errorf("error open torrserver.db: %w", err)
 	}
 
 	torrs := make([]*torrentOldDB, 0)
@@ -81,7 +82,11 @@ func MigrateTorrents() {
 		return nil
 	})
 	db.Close()
-	if err == nil && len(torrs) > 0 {
+	if err != nil {
+		// torrserver.db isn't removed, migration runs again on next start
+		return fmt.Errorf("error read torrserver.db: %w", err)
+	}
+	if len(torrs) > 0 {
 		for _, torr := range torrs {
 			spec, err := utils.ParseLink(torr.Magnet)
 			if err != nil {
@@ -93,15 +98,20 @@ func MigrateTorrents() {
 				title = spec.DisplayName
 			}
 			log.TLogln("Migrate torrent", torr.Name, torr.Hash, torr.Size)
-			AddTorrent(&TorrentDB{
+			buf, err := json.Marshal(&TorrentDB{
 				TorrentSpec: spec,
 				Title:       title,
 				Timestamp:   torr.Timestamp,
 				Size:        torr.Size,
 			})
+			if err != nil {
+				return err
+			}
+			m.Set("Torrents", spec.InfoHash.HexString(), buf)
 		}
 	}
-	os.Remove(filepath.Join(Path, "torrserver.db"))
+	// torrserver.db is kept as backup to be restored by rollback
+	return m.BackupFile(filepath.Join(Path, "torrserver.db"))
 }
 
 func b2i(v []byte) int64 {
@@ -109,85 +119,172 @@ func b2i(v []byte) int64 {
 }
 
 /*
-	=== MigrateToJson ===
+	=== migrateToJson ===
 
 Migrate 'Settings' and 'Viewed' buckets from BBolt ('config.db')
-to separate JSON files ('settings.json' and 'viewed.json')
+to their routes, separate JSON files ('settings.json' and 'viewed.json') by default
 
 'Torrents' data continues to remain in the BBolt database ('config.db')
 due to the fact that BLOBs are stored there
 
 To make user be able to roll settings back, no data is deleted from 'config.db' file.
 */
-func MigrateToJson(bboltDB, jsonDB TorrServerDB) error {
-	var err error = nil
-
+func migrateToJson(m *Migrator) error {
 	const XPATH_SETTINGS = "Settings"
 	const NAME_BITTORR = "BitTorr"
 	const XPATH_VIEWED = "Viewed"
 
 	if BTsets != nil {
-		msg := "Migrate0002 MUST be called before initializing BTSets"
-		log.TLogln(msg)
-		os.Exit(1)
-	}
-
-	isByteArraysEqualJson := func(a, b []byte) (bool, error) {
-		var objectA interface{}
-		var objectB interface{}
-		var err error = nil
-		if err = json.Unmarshal(a, &objectA); err == nil {
-			if err = json.Unmarshal(b, &objectB); err == nil {
-				return reflect.DeepEqual(objectA, objectB), nil
-			} else {
-				err = fmt.Errorf("error unmashalling B: %s", err.Error())
-			}
-		} else {
-			err = fmt.Errorf("error unmashalling A: %s", err.Error())
-		}
-		return false, err
+		return errors.New("migrateToJson MUST be called before initializing BTSets")
 	}
 
 	migrateXPath := func(xPath, name string) error {
-		if jsonDB.Get(xPath, name) == nil {
-			bboltDBBlob := bboltDB.Get(xPath, name)
-			if bboltDBBlob != nil {
-				log.TLogln(fmt.Sprintf("Attempting to migrate %s->%s from TDB to JsonDB", xPath, name))
-				jsonDB.Set(xPath, name, bboltDBBlob)
-				jsonDBBlob := jsonDB.Get(xPath, name)
-				if isEqual, err := isByteArraysEqualJson(bboltDBBlob, jsonDBBlob); err == nil {
-					if isEqual {
-						log.TLogln(fmt.Sprintf("Migrated %s->%s successful", xPath, name))
-					} else {
-						msg := fmt.Sprintf("Failed to migrate %s->%s TDB to JsonDB: equality check failed", xPath, name)
-						log.TLogln(msg)
-						return errors.New(msg)
-					}
-				} else {
-					msg := fmt.Sprintf("Failed to migrate %s->%s TDB to JsonDB: %s", xPath, name, err)
-					log.TLogln(msg)
-					return errors.New(msg)
-				}
-			}
+		if m.Get(xPath, name) != nil {
+			return nil
+		}
+		bboltDBBlob := m.bboltDB.Get(xPath, name)
+		if bboltDBBlob == nil {
+			return nil
+		}
+		log.TLogln(fmt.Sprintf("Migrate %s->%s from TDB to JsonDB", xPath, name))
+		m.Set(xPath, name, bboltDBBlob)
+		if m.DryRun {
+			return nil
+		}
+		if isEqual, err := isByteArraysEqualJson(bboltDBBlob, m.Get(xPath, name)); err != nil {
+			return fmt.Errorf("failed to migrate %s->%s TDB to JsonDB: %w", xPath, name, err)
+		} else if !isEqual {
+			return fmt.Errorf("failed to migrate %s->%s TDB to JsonDB: equality check failed", xPath, name)
 		}
 		return nil
 	}
 
-	if err = migrateXPath(XPATH_SETTINGS, NAME_BITTORR); err != nil {
+	if err := migrateXPath(XPATH_SETTINGS, NAME_BITTORR); err != nil {
 		return err
 	}
 
-	jsonDBViewedNames := jsonDB.List(XPATH_VIEWED)
-	if len(jsonDBViewedNames) <= 0 {
-		bboltDBViewedNames := bboltDB.List(XPATH_VIEWED)
-		if len(bboltDBViewedNames) > 0 {
-			for _, name := range bboltDBViewedNames {
-				err = migrateXPath(XPATH_VIEWED, name)
-				if err != nil {
-					break
+	if len(m.List(XPATH_VIEWED)) == 0 {
+		for _, name := range m.bboltDB.List(XPATH_VIEWED) {
+			if err := migrateXPath(XPATH_VIEWED, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isByteArraysEqualJson reports if JSON values are equal, formatting of JSON is ignored
+func isByteArraysEqualJson(a, b []byte) (bool, error) {
+	var objectA interface{}
+	var objectB interface{}
+	if err := json.Unmarshal(a, &objectA); err != nil {
+		return false, fmt.Errorf("error unmashalling A: %w", err)
+	}
+	if err := json.Unmarshal(b, &objectB); err != nil {
+		return false, fmt.Errorf("error unmashalling B: %w", err)
+	}
+	return reflect.DeepEqual(objectA, objectB), nil
+}
+
+/*
+	=== MigrateToSQLite ===
+
+Copy entries of routes moved to SQLite ('config.sqlite') from DBs they were stored in before.
+
+Entries of route are written in one transaction, so route is copied entirely or not at all,
+and route is copied only while it has no entries in SQLite, so it runs once per route.
+It isn't registered in migrations as routes are chosen on start and can be changed later,
+it runs before them, so they change entries in SQLite.
+To make user be able to roll back, no data is deleted from 'config.db' and JSON files.
+*/
+
+// routeImporter is DB writing all entries of route in one transaction
+type routeImporter interface {
+	Import(xPath string, entries map[string][]byte) error
+}
+
+func MigrateToSQLite(from map[string]TorrServerDB, sqliteDB TorrServerDB) error {
+	if sqliteDB == nil {
+		return nil
+	}
+	importer, ok := sqliteDB.(routeImporter)
+	if !ok {
+		return errors.New("SQLiteDB doesn't support import of routes")
+	}
+	for xPath, db := range from {
+		if len(sqliteDB.List(xPath)) > 0 {
+			continue
+		}
+		names := db.List(xPath)
+		if len(names) == 0 {
+			continue
+		}
+		if ReadOnly {
+			log.TLogln(fmt.Sprintf("Skip migrate %s to SQLiteDB: Read-only DB mode!", xPath))
+			continue
+		}
+		log.TLogln(fmt.Sprintf("Attempting to migrate %d entries of %s to SQLiteDB", len(names), xPath))
+		entries := make(map[string][]byte, len(names))
+		for _, name := range names {
+			if value := db.Get(xPath, name); value != nil {
+				entries[name] = value
+			}
+		}
+		if err := importer.Import(xPath, entries); err != nil {
+			log.TLogln(fmt.Sprintf("Failed to migrate %s to SQLiteDB:", xPath), err)
+			return err
+		}
+		for name, value := range entries {
+			if !bytes.Equal(sqliteDB.Get(xPath, name), value) {
+				msg := fmt.Sprintf("Failed to migrate %s->%s to SQLiteDB: equality check failed", xPath, name)
+				log.TLogln(msg)
+				// route is emptied to be copied again on next start
+				for key := range entries {
+					sqliteDB.Rem(xPath, key)
 				}
+				return errors.New(msg)
 			}
 		}
+		log.TLogln(fmt.Sprintf("Migrated %s to SQLiteDB successful", xPath))
+	}
+	return nil
+}
+
+/*
+	=== migrateAccounts ===
+
+Import users from plain text 'accs.db' to 'Users' with hashed passwords.
+All imported users get admin role, as before roles every user had full access.
+
+Migration imports users only if there are no users, 'accs.db' is not deleted.
+*/
+func migrateAccounts(m *Migrator) error {
+	if len(m.List("Users")) > 0 {
+		return nil
+	}
+	buf, err := os.ReadFile(filepath.Join(Path, "accs.db"))
+	if err != nil {
+		return nil
+	}
+	var accs map[string]string
+	if err = json.Unmarshal(buf, &accs); err != nil {
+		log.TLogln("Error parse accs.db", err)
+		return nil
+	}
+	for name, pass := range accs {
+		if name == "" || pass == "" {
+			continue
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		buf, err := json.Marshal(&User{Name: name, Password: string(hash), Role: RoleAdmin})
+		if err != nil {
+			return err
+		}
+		m.Set("Users", name, buf)
+		log.TLogln("Migrated user", name, "from accs.db")
 	}
-	return err
+	return nil
 }
@@ -0,0 +1,235 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"server/log"
+)
+
+// Migration is step of DB migration, steps run once in order of versions,
+// applied steps are kept in 'Migrations' with changed entries for rollback
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(m *Migrator) error
+}
+
+// migrations registry, new steps are appended with next version, versions are never reused
+var migrations = []*Migration{
+	{Version: 1, Name: "Torrents from torrserver.db to config.db", Up: migrateTorrents},
+	{Version: 2, Name: "Settings and viewed from config.db to JSON", Up: migrateToJson},
+	{Version: 3, Name: "Users from accs.db", Up: migrateAccounts},
+}
+
+// MigrationChange is DB entry changed by migration, Old is nil if entry didn't exist.
+// File change is old DB file File renamed to Backup.
+type MigrationChange struct {
+	XPath  string `json:"xpath,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Old    []byte `json:"old,omitempty"`
+	File   string `json:"file,omitempty"`
+	Backup string `json:"backup,omitempty"`
+}
+
+type MigrationState struct {
+	Version int                `json:"version"`
+	Name    string             `json:"name"`
+	Applied int64              `json:"applied,omitempty"` // unix time, 0 if pending
+	Changes []*MigrationChange `json:"changes,omitempty"`
+}
+
+// Migrator is passed to migration steps, entries must be changed by its Set and Rem
+// to be rolled back, in dry run changes are only logged
+type Migrator struct {
+	DryRun  bool
+	bboltDB TorrServerDB // config.db for migration of old buckets
+	changes []*MigrationChange
+}
+
+func (m *Migrator) Get(xPath, name string) []byte {
+	return tdb.Get(xPath, name)
+}
+
+func (m *Migrator) List(xPath string) []string {
+	return tdb.List(xPath)
+}
+
+func (m *Migrator) Set(xPath, name string, value []byte) {
+	m.changes = append(m.changes, &MigrationChange{XPath: xPath, Name: name, Old: tdb.Get(xPath, name)})
+	if m.DryRun {
+		log.TLogln("Migration dry run: set", xPath+"/"+name)
+		return
+	}
+	tdb.Set(xPath, name, value)
+}
+
+func (m *Migrator) Rem(xPath, name string) {
+	old := tdb.Get(xPath, name)
+	if old == nil {
+		return
+	}
+	m.changes = append(m.changes, &MigrationChange{XPath: xPath, Name: name, Old: old})
+	if m.DryRun {
+		log.TLogln("Migration dry run: remove", xPath+"/"+name)
+		return
+	}
+	tdb.Rem(xPath, name)
+}
+
+// BackupFile renames migrated old DB file to .bak, rollback renames it back
+func (m *Migrator) BackupFile(name string) error {
+	backup := name + ".bak"
+	if m.DryRun {
+		log.TLogln("Migration dry run: rename file", name, "to", backup)
+		return nil
+	}
+	if err := os.Rename(name, backup); err != nil {
+		return err
+	}
+	m.changes = append(m.changes, &MigrationChange{File: name, Backup: backup})
+	return nil
+}
+
+// undo restores changed entries in reverse order
+func undo(changes []*MigrationChange) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		ch := changes[i]
+		if ch.File != "" {
+			if err := os.Rename(ch.Backup, ch.File); err != nil {
+				log.TLogln("Error restore file", ch.File, err)
+			}
+		} else if ch.Old == nil {
+			tdb.Rem(ch.XPath, ch.Name)
+		} else {
+			tdb.Set(ch.XPath, ch.Name, ch.Old)
+		}
+	}
+}
+
+func migrationKey(version int) string {
+	return fmt.Sprintf("%04d", version)
+}
+
+func getMigration(version int) *MigrationState {
+	buf := tdb.Get("Migrations", migrationKey(version))
+	if len(buf) == 0 {
+		return nil
+	}
+	var st *MigrationState
+	if err := json.Unmarshal(buf, &st); err != nil {
+		log.TLogln("Error get migration", version, err)
+		return nil
+	}
+	return st
+}
+
+// RunMigrations runs not applied migrations in order, changes of failed step are rolled back
+// and later steps are not run. In read-only DB mode migrations are run dry.
+func RunMigrations(bboltDB TorrServerDB) error {
+	for _, mg := range migrations {
+		if getMigration(mg.Version) != nil {
+			continue
+		}
+		m := &Migrator{DryRun: ReadOnly, bboltDB: bboltDB}
+		if err := mg.Up(m); err != nil {
+			if !m.DryRun {
+				undo(m.changes)
+			}
+			return fmt.Errorf("migration %d %q failed: %w", mg.Version, mg.Name, err)
+		}
+		if m.DryRun {
+			log.TLogln(fmt.Sprintf("Migration %d %q pending, %d entries to change", mg.Version, mg.Name, len(m.changes)))
+			continue
+		}
+		st := &MigrationState{
+			Version: mg.Version,
+			Name:    mg.Name,
+			Applied: time.Now().Unix(),
+			Changes: m.changes,
+		}
+		buf, err := json.Marshal(st)
+		if err != nil {
+			undo(m.changes)
+			return err
+		}
+		tdb.Set("Migrations", migrationKey(mg.Version), buf)
+		log.TLogln(fmt.Sprintf("Migration %d %q applied, %d entries changed", mg.Version, mg.Name, len(m.changes)))
+	}
+	return nil
+}
+
+// RollbackMigrations rolls back applied migrations with version greater than version,
+// in reverse order. Entries changed by migration are restored, so changes made after it are lost.
+// Rollback is for downgrade only, older version must be started after it, as rolled back steps
+// run again on next start of the same version. In read-only DB mode rollback is run dry.
+func RollbackMigrations(version int) error {
+	list := ListMigrations()
+	rolled := false
+	for i := len(list) - 1; i >= 0; i-- {
+		st := list[i]
+		if st.Version <= version || st.Applied == 0 {
+			continue
+		}
+		if ReadOnly {
+			log.TLogln(fmt.Sprintf("Migration dry run: rollback %d %q, %d entries to restore", st.Version, st.Name, len(st.Changes)))
+			continue
+		}
+		undo(st.Changes)
+		tdb.Rem("Migrations", migrationKey(st.Version))
+		log.TLogln(fmt.Sprintf("Migration %d %q rolled back, %d entries restored", st.Version, st.Name, len(st.Changes)))
+		rolled = true
+	}
+	if rolled {
+		log.TLogln("Start older version now, rolled back migrations run again on next start of this version")
+	}
+	return nil
+}
+
+// ListMigrations returns registered and applied migrations sorted by version
+func ListMigrations() []*MigrationState {
+	states := make(map[int]*MigrationState)
+	for _, name := range tdb.List("Migrations") {
+		version, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		if st := getMigration(version); st != nil {
+			states[version] = st
+		}
+	}
+	for _, mg := range migrations {
+		if _, ok := states[mg.Version]; !ok {
+			states[mg.Version] = &MigrationState{Version: mg.Version, Name: mg.Name}
+		}
+	}
+	list := make([]*MigrationState, 0, len(states))
+	for _, st := range states {
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
+
+// SchemaVersion returns version of last applied migration, steps are applied in order
+func SchemaVersion() int {
+	version := 0
+	for _, st := range ListMigrations() {
+		if st.Applied == 0 {
+			break
+		}
+		version = st.Version
+	}
+	return version
+}
+
+// LatestSchemaVersion returns version of last registered migration
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
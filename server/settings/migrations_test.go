@@ -0,0 +1,236 @@
+package settings
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// memDB keeps entries in memory for tests
+type memDB struct {
+	entries map[string]map[string][]byte
+}
+
+func newMemDB() *memDB {
+	return &memDB{entries: make(map[string]map[string][]byte)}
+}
+
+func (v *memDB) CloseDB() {}
+
+func (v *memDB) Get(xPath, name string) []byte {
+	return v.entries[xPath][name]
+}
+
+func (v *memDB) Set(xPath, name string, value []byte) {
+	if v.entries[xPath] == nil {
+		v.entries[xPath] = make(map[string][]byte)
+	}
+	v.entries[xPath][name] = value
+}
+
+func (v *memDB) List(xPath string) []string {
+	var names []string
+	for name := range v.entries[xPath] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (v *memDB) Rem(xPath, name string) {
+	delete(v.entries[xPath], name)
+}
+
+// withMigrations replaces DB and registered migrations for test
+func withMigrations(t *testing.T, readOnly bool, list ...*Migration) {
+	oldDB, oldList, oldReadOnly := tdb, migrations, ReadOnly
+	tdb, migrations, ReadOnly = newMemDB(), list, readOnly
+	t.Cleanup(func() {
+		tdb, migrations, ReadOnly = oldDB, oldList, oldReadOnly
+	})
+}
+
+func get(name string) string {
+	return string(tdb.Get("Test", name))
+}
+
+func TestRunMigrations(t *testing.T) {
+	runs := 0
+	withMigrations(t, false,
+		&Migration{Version: 1, Name: "set a", Up: func(m *Migrator) error {
+			runs++
+			m.Set("Test", "a", []byte("1"))
+			return nil
+		}},
+		&Migration{Version: 2, Name: "change a, remove b", Up: func(m *Migrator) error {
+			runs++
+			m.Set("Test", "a", []byte("2"))
+			m.Rem("Test", "b")
+			return nil
+		}},
+	)
+	tdb.Set("Test", "b", []byte("b"))
+
+	if err := RunMigrations(nil); err != nil {
+		t.Fatal(err)
+	}
+	if get("a") != "2" || tdb.Get("Test", "b") != nil {
+		t.Errorf("entries after migrations: a=%q b=%q", get("a"), get("b"))
+	}
+	if v := SchemaVersion(); v != 2 {
+		t.Errorf("SchemaVersion() = %d, want 2", v)
+	}
+
+	// applied steps are not run again
+	if err := RunMigrations(nil); err != nil || runs != 2 {
+		t.Errorf("second run: err %v, steps run %d times, want 2", err, runs)
+	}
+
+	if err := RollbackMigrations(1); err != nil {
+		t.Fatal(err)
+	}
+	if get("a") != "1" || get("b") != "b" || SchemaVersion() != 1 {
+		t.Errorf("rollback to 1: a=%q b=%q version %d", get("a"), get("b"), SchemaVersion())
+	}
+	if err := RollbackMigrations(0); err != nil {
+		t.Fatal(err)
+	}
+	if tdb.Get("Test", "a") != nil || get("b") != "b" || SchemaVersion() != 0 {
+		t.Errorf("rollback to 0: a=%q b=%q version %d", get("a"), get("b"), SchemaVersion())
+	}
+}
+
+func TestRunMigrationsFailed(t *testing.T) {
+	ran := false
+	withMigrations(t, false,
+		&Migration{Version: 1, Name: "ok", Up: func(m *Migrator) error {
+			m.Set("Test", "a", []byte("1"))
+			return nil
+		}},
+		&Migration{Version: 2, Name: "failed", Up: func(m *Migrator) error {
+			m.Set("Test", "a", []byte("2"))
+			m.Set("Test", "b", []byte("2"))
+			return errors.New("failed")
+		}},
+		&Migration{Version: 3, Name: "after failed", Up: func(m *Migrator) error {
+			ran = true
+			return nil
+		}},
+	)
+
+	if err := RunMigrations(nil); err == nil {
+		t.Fatal("RunMigrations() error is nil, want error of failed step")
+	}
+	if get("a") != "1" || tdb.Get("Test", "b") != nil {
+		t.Errorf("changes of failed step are not rolled back: a=%q b=%q", get("a"), get("b"))
+	}
+	if ran {
+		t.Error("step after failed one is run")
+	}
+	if v := SchemaVersion(); v != 1 {
+		t.Errorf("SchemaVersion() = %d, want 1", v)
+	}
+}
+
+func TestRunMigrationsDryRun(t *testing.T) {
+	withMigrations(t, true, &Migration{Version: 1, Name: "set a", Up: func(m *Migrator) error {
+		m.Set("Test", "a", []byte("1"))
+		m.Rem("Test", "b")
+		return nil
+	}})
+	tdb.Set("Test", "b", []byte("b"))
+
+	if err := RunMigrations(nil); err != nil {
+		t.Fatal(err)
+	}
+	if tdb.Get("Test", "a") != nil || get("b") != "b" {
+		t.Errorf("dry run changed entries: a=%q b=%q", get("a"), get("b"))
+	}
+	if v := SchemaVersion(); v != 0 {
+		t.Errorf("SchemaVersion() = %d, want 0", v)
+	}
+}
+
+func TestBackupFile(t *testing.T) {
+	withMigrations(t, false)
+	name := filepath.Join(t.TempDir(), "torrserver.db")
+	if err := os.WriteFile(name, []byte("db"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Migrator{}
+	if err := m.BackupFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name + ".bak"); err != nil {
+		t.Errorf("backup of file: %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("file exists after backup, err %v", err)
+	}
+
+	undo(m.changes)
+	if buf, err := os.ReadFile(name); err != nil || string(buf) != "db" {
+		t.Errorf("file after undo = %q, err %v", buf, err)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial map[string]string
+		changes []*MigrationChange
+		want    map[string]string
+	}{
+		{
+			name:    "added entry is removed",
+			initial: map[string]string{"a": "1"},
+			changes: []*MigrationChange{{XPath: "Test", Name: "a"}},
+			want:    map[string]string{},
+		},
+		{
+			name:    "changed entry is restored",
+			initial: map[string]string{"a": "2"},
+			changes: []*MigrationChange{{XPath: "Test", Name: "a", Old: []byte("1")}},
+			want:    map[string]string{"a": "1"},
+		},
+		{
+			name:    "entry changed twice gets first value",
+			initial: map[string]string{"a": "3"},
+			changes: []*MigrationChange{
+				{XPath: "Test", Name: "a", Old: []byte("1")},
+				{XPath: "Test", Name: "a", Old: []byte("2")},
+			},
+			want: map[string]string{"a": "1"},
+		},
+		{
+			name:    "removed entry is restored",
+			initial: map[string]string{},
+			changes: []*MigrationChange{{XPath: "Test", Name: "b", Old: []byte("b")}},
+			want:    map[string]string{"b": "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withMigrations(t, false)
+			for name, value := range tt.initial {
+				tdb.Set("Test", name, []byte(value))
+			}
+			undo(tt.changes)
+			got := make(map[string]string)
+			for _, name := range tdb.List("Test") {
+				got[name] = get(name)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("undo() entries = %v, want %v", got, tt.want)
+			}
+			for name, value := range tt.want {
+				if got[name] != value {
+					t.Errorf("undo() entries = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package settings
+
+import (
+	"strings"
+)
+
+// TorrentPolicy overrides global settings for torrents of category or for torrent hash,
+// zero values keep global settings
+type TorrentPolicy struct {
+	CacheSize         int64 // in byte
+	ReaderReadAHead   int   // in percent, 5%-100%
+	PreloadCache      int   // in percent
+	ConnectionsLimit  int
+	DownloadRateLimit int // in kb
+}
+
+func checkPolicy(p *TorrentPolicy) {
+	if p.CacheSize < 0 {
+		p.CacheSize = 0
+	}
+	if p.ReaderReadAHead != 0 && p.ReaderReadAHead < 5 {
+		p.ReaderReadAHead = 5
+	}
+	if p.ReaderReadAHead > 100 {
+		p.ReaderReadAHead = 100
+	}
+	if p.PreloadCache < 0 {
+		p.PreloadCache = 0
+	}
+	if p.PreloadCache > 100 {
+		p.PreloadCache = 100
+	}
+	if p.ConnectionsLimit < 0 {
+		p.ConnectionsLimit = 0
+	}
+	if p.DownloadRateLimit < 0 {
+		p.DownloadRateLimit = 0
+	}
+}
+
+func (p *TorrentPolicy) merge(o *TorrentPolicy) {
+	if o == nil {
+		return
+	}
+	if o.CacheSize > 0 {
+		p.CacheSize = o.CacheSize
+	}
+	if o.ReaderReadAHead > 0 {
+		p.ReaderReadAHead = o.ReaderReadAHead
+	}
+	if o.PreloadCache > 0 {
+		p.PreloadCache = o.PreloadCache
+	}
+	if o.ConnectionsLimit > 0 {
+		p.ConnectionsLimit = o.ConnectionsLimit
+	}
+	if o.DownloadRateLimit > 0 {
+		p.DownloadRateLimit = o.DownloadRateLimit
+	}
+}
+
+// GetPolicy returns settings for torrent: global settings overridden
+// by policy of category and then by policy of hash
+func GetPolicy(hash, category string) *TorrentPolicy {
+	p := &TorrentPolicy{}
+	if BTsets == nil {
+		return p
+	}
+	p.CacheSize = BTsets.CacheSize
+	p.ReaderReadAHead = BTsets.ReaderReadAHead
+	p.PreloadCache = BTsets.PreloadCache
+	p.ConnectionsLimit = BTsets.ConnectionsLimit
+	if category != "" {
+		p.merge(BTsets.TorrentPolicies[strings.ToLower(category)])
+	}
+	if hash != "" {
+		p.merge(BTsets.TorrentPolicies[strings.ToLower(hash)])
+	}
+	return p
+}
@@ -0,0 +1,118 @@
+package settings
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateSchedule is rate limits profile active on days of week in time range,
+// Start and End in "HH:MM" local time, End before Start means range over midnight
+type RateSchedule struct {
+	Name              string
+	Days              []int // 0 - Sunday ... 6 - Saturday, empty - every day
+	Start             string
+	End               string
+	DownloadRateLimit int // in kb, 0 - inf
+	UploadRateLimit   int // in kb, 0 - inf
+}
+
+// parseClock returns minutes from midnight of "HH:MM"
+func parseClock(s string) (int, bool) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, false
+	}
+	h, err := strconv.Atoi(hh)
+	if err != nil || h < 0 || h > 24 {
+		return 0, false
+	}
+	m, err := strconv.Atoi(mm)
+	if err != nil || m < 0 || m > 59 || (h == 24 && m > 0) {
+		return 0, false
+	}
+	return h*60 + m, true
+}
+
+func checkSchedules(list []*RateSchedule) []*RateSchedule {
+	ret := make([]*RateSchedule, 0, len(list))
+	for _, s := range list {
+		if s == nil {
+			continue
+		}
+		if _, ok := parseClock(s.Start); !ok {
+			continue
+		}
+		if _, ok := parseClock(s.End); !ok {
+			continue
+		}
+		days := make([]int, 0, len(s.Days))
+		for _, d := range s.Days {
+			if d >= 0 && d <= 6 {
+				days = append(days, d)
+			}
+		}
+		s.Days = days
+		if strings.TrimSpace(s.Name) == "" {
+			s.Name = s.Start + "-" + s.End
+		}
+		if s.DownloadRateLimit < 0 {
+			s.DownloadRateLimit = 0
+		}
+		if s.UploadRateLimit < 0 {
+			s.UploadRateLimit = 0
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+func (s *RateSchedule) onDay(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports if schedule is active at time t
+func (s *RateSchedule) Active(t time.Time) bool {
+	start, ok := parseClock(s.Start)
+	if !ok {
+		return false
+	}
+	end, ok := parseClock(s.End)
+	if !ok {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return s.onDay(t.Weekday()) && now >= start && now < end
+	}
+	// over midnight, the part after midnight belongs to the previous day
+	if now >= start {
+		return s.onDay(t.Weekday())
+	}
+	if now < end {
+		return s.onDay(t.AddDate(0, 0, -1).Weekday())
+	}
+	return false
+}
+
+// GetRateLimits returns rate limits in kb of first schedule active at time t,
+// global rate limits if no schedule is active
+func GetRateLimits(t time.Time) (download, upload int, schedule string) {
+	if BTsets == nil {
+		return
+	}
+	for _, s := range BTsets.RateSchedules {
+		if s.Active(t) {
+			return s.DownloadRateLimit, s.UploadRateLimit, s.Name
+		}
+	}
+	return BTsets.DownloadRateLimit, BTsets.UploadRateLimit, ""
+}
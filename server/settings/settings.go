@@ -23,6 +23,7 @@ var (
 	PubIPv6         string
 	TorAddr         string
 	MaxSize         int64
+	SQLiteRoutes    []string // DB routes stored in SQLite, "all" for all routes
 )
 
 func InitSets(readOnly, searchWA bool) {
@@ -42,17 +43,42 @@ func InitSets(readOnly, searchWA bool) {
 		os.Exit(1)
 	}
 
+	var sqliteDB TorrServerDB
+	if len(SQLiteRoutes) > 0 {
+		if sqliteDB = NewSQLiteDB(); sqliteDB == nil {
+			log.TLogln("Error open SQLiteDB:", filepath.Join(Path, "config.sqlite"), "routes stay in default DBs")
+		}
+	}
 	dbRouter := NewXPathDBRouter()
 	// First registered DB becomes default route
-	dbRouter.RegisterRoute(jsonDB, "Settings")
-	dbRouter.RegisterRoute(jsonDB, "Viewed")
-	dbRouter.RegisterRoute(bboltDB, "Torrents")
-	
+	dbRouter.RegisterRoute(jsonDB, "")
+
+	// routes moved to SQLite and DBs they are migrated from
+	sqliteFrom := map[string]TorrServerDB{}
+	register := func(db TorrServerDB, xPath string) {
+		if sqliteDB != nil && isSQLiteRoute(xPath) {
+			sqliteFrom[xPath] = db
+			db = sqliteDB
+		}
+		dbRouter.RegisterRoute(db, xPath)
+	}
+	register(jsonDB, "Settings")
+	register(jsonDB, "Viewed")
+	register(jsonDB, "MediaInfo")
+	register(bboltDB, "Torrents")
+	if sqliteDB != nil && isSQLiteRoute("Users") {
+		register(jsonDB, "Users")
+	}
+
 	tdb = NewDBReadCache(dbRouter)
 
 	// We migrate settings here, it must be done before loadBTSets()
-	if err := MigrateToJson(bboltDB, jsonDB); err != nil {
-		log.TLogln("MigrateToJson failed")
+	if err := MigrateToSQLite(sqliteFrom, sqliteDB); err != nil {
+		log.TLogln("MigrateToSQLite failed")
+		os.Exit(1)
+	}
+	if err := RunMigrations(bboltDB); err != nil {
+		log.TLogln("Migrations failed:", err)
 		os.Exit(1)
 	}
 	loadBTSets()
@@ -62,7 +88,16 @@ func InitSets(readOnly, searchWA bool) {
 			BTsets.StreamLinksPath = cliStreamLinks
 		}
 	}
-	MigrateTorrents()
+}
+
+func isSQLiteRoute(xPath string) bool {
+	for _, route := range SQLiteRoutes {
+		route = strings.TrimSpace(route)
+		if strings.EqualFold(route, "all") || strings.EqualFold(route, xPath) {
+			return true
+		}
+	}
+	return false
 }
 
 func CloseDB() {
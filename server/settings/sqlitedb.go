@@ -0,0 +1,131 @@
+//go:build !mips && !mipsle && !mips64 && !mips64le && !(freebsd && arm)
+// +build !mips
+// +build !mipsle
+// +build !mips64
+// +build !mips64le
+// +build !freebsd !arm
+
+package settings
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+
+	"server/log"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteDB keeps entries in table 'entries' of 'config.sqlite' file,
+// values are JSON text, so DB can be inspected by sqlite3 tool
+type SQLiteDB struct {
+	Path string
+	db   *sql.DB
+}
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS entries (
+	xpath TEXT NOT NULL,
+	name  TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (xpath, name)
+)`
+
+func NewSQLiteDB() TorrServerDB {
+	path := filepath.Join(Path, "config.sqlite")
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		log.TLogln("SQLiteDB: error open", path, err)
+		return nil
+	}
+	// one writer at a time, sqlite locks whole DB on write
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		log.TLogln("SQLiteDB: error create schema", path, err)
+		db.Close()
+		return nil
+	}
+	return &SQLiteDB{Path: Path, db: db}
+}
+
+func (v *SQLiteDB) CloseDB() {
+	if v.db != nil {
+		v.db.Close()
+		v.db = nil
+	}
+}
+
+func (v *SQLiteDB) Get(xPath, name string) []byte {
+	var value string
+	err := v.db.QueryRow("SELECT value FROM entries WHERE xpath = ? AND name = ?", xPath, name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		v.log(fmt.Sprintf("Get: error reading entry %s->%s", xPath, name), err)
+		return nil
+	}
+	return []byte(value)
+}
+
+func (v *SQLiteDB) Set(xPath, name string, value []byte) {
+	_, err := v.db.Exec("INSERT INTO entries (xpath, name, value) VALUES (?, ?, ?) "+
+		"ON CONFLICT (xpath, name) DO UPDATE SET value = excluded.value", xPath, name, string(value))
+	if err != nil {
+		v.log(fmt.Sprintf("Set: error writing entry %s->%s", xPath, name), err)
+	}
+}
+
+// Import writes entries of xPath in one transaction, so route is copied entirely or not at all
+func (v *SQLiteDB) Import(xPath string, entries map[string][]byte) error {
+	tx, err := v.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("INSERT INTO entries (xpath, name, value) VALUES (?, ?, ?) " +
+		"ON CONFLICT (xpath, name) DO UPDATE SET value = excluded.value")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for name, value := range entries {
+		if _, err = stmt.Exec(xPath, name, string(value)); err != nil {
+			return fmt.Errorf("error writing entry %s->%s: %w", xPath, name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (v *SQLiteDB) List(xPath string) []string {
+	rows, err := v.db.Query("SELECT name FROM entries WHERE xpath = ? ORDER BY name", xPath)
+	if err != nil {
+		v.log(fmt.Sprintf("List: error reading entries in xPath %s", xPath), err)
+		return nil
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			v.log(fmt.Sprintf("List: error reading entries in xPath %s", xPath), err)
+			return nil
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func (v *SQLiteDB) Rem(xPath, name string) {
+	if _, err := v.db.Exec("DELETE FROM entries WHERE xpath = ? AND name = ?", xPath, name); err != nil {
+		v.log(fmt.Sprintf("Rem: error removing entry %s->%s", xPath, name), err)
+	}
+}
+
+func (v *SQLiteDB) log(s string, params ...interface{}) {
+	if len(params) > 0 {
+		log.TLogln(fmt.Sprintf("SQLiteDB: %s: %s", s, fmt.Sprint(params...)))
+	} else {
+		log.TLogln(fmt.Sprintf("SQLiteDB: %s", s))
+	}
+}
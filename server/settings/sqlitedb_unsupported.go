@@ -0,0 +1,12 @@
+//go:build mips || mipsle || mips64 || mips64le || (freebsd && arm)
+// +build mips mipsle mips64 mips64le freebsd,arm
+
+package settings
+
+import "server/log"
+
+// NewSQLiteDB returns nil, pure Go sqlite doesn't support mips and freebsd/arm
+func NewSQLiteDB() TorrServerDB {
+	log.TLogln("SQLiteDB: not supported on this platform")
+	return nil
+}
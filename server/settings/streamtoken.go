@@ -0,0 +1,105 @@
+package settings
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/log"
+)
+
+var (
+	streamSecret   []byte
+	muStreamSecret sync.Mutex
+)
+
+func getStreamSecret() []byte {
+	muStreamSecret.Lock()
+	defer muStreamSecret.Unlock()
+	if streamSecret != nil {
+		return streamSecret
+	}
+
+	var sec struct {
+		Key string `json:"key"`
+	}
+	if buf := tdb.Get("Settings", "StreamSecret"); len(buf) > 0 {
+		if err := json.Unmarshal(buf, &sec); err == nil {
+			if key, err := hex.DecodeString(sec.Key); err == nil && len(key) > 0 {
+				streamSecret = key
+				return streamSecret
+			}
+		}
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.TLogln("Error generate stream secret:", err)
+	}
+	sec.Key = hex.EncodeToString(key)
+	if buf, err := json.Marshal(sec); err == nil {
+		tdb.Set("Settings", "StreamSecret", buf)
+	}
+	streamSecret = key
+	return streamSecret
+}
+
+func signStream(hash string, index int, exp int64) string {
+	mac := hmac.New(sha256.New, getStreamSecret())
+	fmt.Fprintf(mac, "%s/%d/%d", strings.ToLower(hash), index, exp)
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// DefaultStreamTokenTTL is lifetime of signed stream links in hours
+const DefaultStreamTokenTTL = 24 * 30
+
+// StreamToken returns signed query "exp=...&sig=..." for stream link,
+// index 0 signs link for all files of torrent
+func StreamToken(hash string, index int) string {
+	ttl := DefaultStreamTokenTTL
+	if BTsets != nil && BTsets.StreamTokenTTL != 0 {
+		ttl = BTsets.StreamTokenTTL
+	}
+	exp := int64(0) // links never expire with negative TTL
+	if ttl > 0 {
+		exp = time.Now().Add(time.Hour * time.Duration(ttl)).Unix()
+	}
+	return "exp=" + strconv.FormatInt(exp, 10) + "&sig=" + signStream(hash, index, exp)
+}
+
+// StreamLinkToken returns "&exp=...&sig=..." to append to stream link if http auth enabled
+func StreamLinkToken(hash string, index int) string {
+	if !HttpAuth {
+		return ""
+	}
+	return "&" + StreamToken(hash, index)
+}
+
+// CheckStreamToken verifies signed stream link for file index or for all files of torrent
+func CheckStreamToken(hash string, index int, expStr, sig string) bool {
+	if sig == "" {
+		return false
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil {
+		return false
+	}
+	if exp > 0 && time.Now().Unix() > exp {
+		return false
+	}
+	// links without expiration are valid only while TTL is negative
+	if exp == 0 && (BTsets == nil || BTsets.StreamTokenTTL >= 0) {
+		return false
+	}
+	if index > 0 && hmac.Equal([]byte(sig), []byte(signStream(hash, index, exp))) {
+		return true
+	}
+	return hmac.Equal([]byte(sig), []byte(signStream(hash, 0, exp)))
+}
@@ -19,8 +19,20 @@ type TorrentDB struct {
 
 	Timestamp int64 `json:"timestamp,omitempty"`
 	Size      int64 `json:"size,omitempty"`
+
+	Keep bool     `json:"keep,omitempty"` // download fully to TorrentsSavePath
+	Tags []string `json:"tags,omitempty"`
+
+	FilePriorities map[int]string `json:"file_priorities,omitempty"` // by file id, normal priority is not stored
 }
 
+// File download priorities
+const (
+	FilePrioritySkip   = "skip"
+	FilePriorityNormal = "normal"
+	FilePriorityHigh   = "high"
+)
+
 type File struct {
 	Name string `json:"name,omitempty"`
 	Id   int    `json:"id,omitempty"`
@@ -75,6 +87,21 @@ func ListTorrent() []*TorrentDB {
 	return list
 }
 
+func GetTorrent(hash metainfo.Hash) *TorrentDB {
+	mu.Lock()
+	defer mu.Unlock()
+
+	buf := tdb.Get("Torrents", hash.HexString())
+	if len(buf) == 0 {
+		return nil
+	}
+	var torr *TorrentDB
+	if err := json.Unmarshal(buf, &torr); err != nil {
+		return nil
+	}
+	return torr
+}
+
 func RemTorrent(hash metainfo.Hash) {
 	mu.Lock()
 	tdb.Rem("Torrents", hash.HexString())
@@ -0,0 +1,92 @@
+package settings
+
+import (
+	"strings"
+)
+
+// TranscodeProfile is ffmpeg transcoding options for players with unsupported codecs
+type TranscodeProfile struct {
+	Name         string
+	VideoCodec   string   // ffmpeg encoder, def libx264, copy - don't transcode video
+	AudioCodec   string   // ffmpeg encoder, def aac, copy - don't transcode audio
+	MaxHeight    int      // in pixels, 0 - keep resolution
+	VideoBitrate int      // in kbit, 0 - encoder default
+	AudioBitrate int      // in kbit, 0 - encoder default
+	UserAgents   []string // parts of User-Agent of players to select profile automatically
+}
+
+var defTranscodeProfiles = []*TranscodeProfile{
+	{Name: "h264-1080p", VideoCodec: "libx264", AudioCodec: "aac", MaxHeight: 1080, AudioBitrate: 192},
+	{Name: "h264-720p", VideoCodec: "libx264", AudioCodec: "aac", MaxHeight: 720, VideoBitrate: 3000, AudioBitrate: 128},
+	{Name: "aac", VideoCodec: "copy", AudioCodec: "aac", AudioBitrate: 192},
+}
+
+func checkTranscodeProfiles(list []*TranscodeProfile) []*TranscodeProfile {
+	ret := make([]*TranscodeProfile, 0, len(list))
+	for _, p := range list {
+		if p == nil || strings.TrimSpace(p.Name) == "" {
+			continue
+		}
+		p.Name = strings.ToLower(strings.TrimSpace(p.Name))
+		if p.VideoCodec == "" {
+			p.VideoCodec = "libx264"
+		}
+		if p.AudioCodec == "" {
+			p.AudioCodec = "aac"
+		}
+		if p.MaxHeight < 0 {
+			p.MaxHeight = 0
+		}
+		if p.VideoBitrate < 0 {
+			p.VideoBitrate = 0
+		}
+		if p.AudioBitrate < 0 {
+			p.AudioBitrate = 0
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// TranscodeProfiles returns profiles from settings or default profiles
+func TranscodeProfiles() []*TranscodeProfile {
+	if BTsets == nil || len(BTsets.TranscodeProfiles) == 0 {
+		return defTranscodeProfiles
+	}
+	return BTsets.TranscodeProfiles
+}
+
+// GetTranscodeProfile returns profile by name, nil if not found
+func GetTranscodeProfile(name string) *TranscodeProfile {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, p := range TranscodeProfiles() {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// SelectTranscodeProfile returns profile for player by User-Agent, nil if player needs no transcoding
+func SelectTranscodeProfile(userAgent string) *TranscodeProfile {
+	if userAgent == "" {
+		return nil
+	}
+	userAgent = strings.ToLower(userAgent)
+	for _, p := range TranscodeProfiles() {
+		for _, ua := range p.UserAgents {
+			if ua != "" && strings.Contains(userAgent, strings.ToLower(ua)) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// TranscodeLimit returns max count of concurrent transcodes
+func TranscodeLimit() int {
+	if BTsets == nil || BTsets.TranscodeLimit <= 0 {
+		return 2
+	}
+	return BTsets.TranscodeLimit
+}
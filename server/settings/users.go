@@ -0,0 +1,127 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"server/log"
+)
+
+const (
+	RoleViewer   = "viewer"   // stream, playlists and torrents info
+	RoleUploader = "uploader" // viewer + add, edit and upload torrents
+	RoleAdmin    = "admin"    // full access
+)
+
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"` // bcrypt hash
+	Role     string `json:"role"`
+}
+
+// RoleLevel returns access level of role, 0 for unknown role
+func RoleLevel(role string) int {
+	switch role {
+	case RoleViewer:
+		return 1
+	case RoleUploader:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+func GetUser(name string) *User {
+	buf := tdb.Get("Users", name)
+	if len(buf) == 0 {
+		return nil
+	}
+	var user *User
+	err := json.Unmarshal(buf, &user)
+	if err != nil {
+		log.TLogln("Error get user:", err)
+		return nil
+	}
+	return user
+}
+
+// SetUser adds or updates user, password is hashed before save.
+// Empty password or role keeps current value of existing user.
+func SetUser(name, password, role string) error {
+	if name == "" {
+		return errors.New("user name is empty")
+	}
+	user := GetUser(name)
+	if user == nil {
+		if password == "" {
+			return errors.New("password is empty")
+		}
+		if role == "" {
+			role = RoleViewer
+		}
+		user = &User{Name: name}
+	}
+	if role != "" {
+		if RoleLevel(role) == 0 {
+			return errors.New("unknown role: " + role)
+		}
+		if user.Role == RoleAdmin && role != RoleAdmin && isLastAdmin(name) {
+			return errors.New("can't demote last admin")
+		}
+		user.Role = role
+	}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		user.Password = string(hash)
+	}
+	buf, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	tdb.Set("Users", name, buf)
+	return nil
+}
+
+// CheckPassword reports whether password matches user password hash
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+// RemUser removes user, last admin can't be removed as nobody could manage users then
+func RemUser(name string) error {
+	if user := GetUser(name); user != nil && user.Role == RoleAdmin && isLastAdmin(name) {
+		return errors.New("can't remove last admin")
+	}
+	tdb.Rem("Users", name)
+	return nil
+}
+
+// isLastAdmin reports whether user is the only admin
+func isLastAdmin(name string) bool {
+	for _, user := range ListUsers() {
+		if user.Role == RoleAdmin && user.Name != name {
+			return false
+		}
+	}
+	return true
+}
+
+func ListUsers() []*User {
+	var list []*User
+	for _, name := range tdb.List("Users") {
+		if user := GetUser(name); user != nil {
+			list = append(list, user)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
@@ -2,53 +2,154 @@ package settings
 
 import (
 	"encoding/json"
+	"sync"
+	"time"
 
 	"server/log"
 )
 
 type Viewed struct {
-	Hash      string `json:"hash"`
-	FileIndex int    `json:"file_index"`
+	Hash      string  `json:"hash"`
+	FileIndex int     `json:"file_index"`
+	Offset    int64   `json:"offset,omitempty"`   // in bytes
+	Length    int64   `json:"length,omitempty"`   // file length in bytes
+	Seconds   float64 `json:"seconds,omitempty"`  // position in seconds
+	Duration  float64 `json:"duration,omitempty"` // file duration in seconds
+	Updated   int64   `json:"updated,omitempty"`  // unix time of last position update
 }
 
-func SetViewed(vv *Viewed) {
-	var indexes map[int]struct{}
-	var err error
+// viewedPos is stored per file index in "Viewed" bucket, old DBs have empty objects here
+type viewedPos struct {
+	Offset   int64   `json:"offset,omitempty"`
+	Length   int64   `json:"length,omitempty"`
+	Seconds  float64 `json:"seconds,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+	Updated  int64   `json:"updated,omitempty"`
+}
+
+// muViewed guards read-modify-write of viewed files of torrent
+var muViewed sync.Mutex
 
-	buf := tdb.Get("Viewed", vv.Hash)
+func getViewed(hash string) (map[int]*viewedPos, error) {
+	indexes := make(map[int]*viewedPos)
+	buf := tdb.Get("Viewed", hash)
 	if len(buf) == 0 {
-		indexes = make(map[int]struct{})
-		indexes[vv.FileIndex] = struct{}{}
-		buf, err = json.Marshal(indexes)
-		if err == nil {
-			tdb.Set("Viewed", vv.Hash, buf)
+		return indexes, nil
+	}
+	err := json.Unmarshal(buf, &indexes)
+	return indexes, err
+}
+
+func putViewed(hash string, indexes map[int]*viewedPos) error {
+	buf, err := json.Marshal(indexes)
+	if err == nil {
+		tdb.Set("Viewed", hash, buf)
+	}
+	return err
+}
+
+func toViewed(hash string, index int, pos *viewedPos) *Viewed {
+	vv := &Viewed{Hash: hash, FileIndex: index}
+	if pos != nil {
+		vv.Offset = pos.Offset
+		vv.Length = pos.Length
+		vv.Seconds = pos.Seconds
+		vv.Duration = pos.Duration
+		vv.Updated = pos.Updated
+	}
+	return vv
+}
+
+func SetViewed(vv *Viewed) {
+	muViewed.Lock()
+	defer muViewed.Unlock()
+	indexes, err := getViewed(vv.Hash)
+	if err == nil {
+		if _, ok := indexes[vv.FileIndex]; !ok {
+			indexes[vv.FileIndex] = &viewedPos{}
+			err = putViewed(vv.Hash, indexes)
 		}
-	} else {
-		err = json.Unmarshal(buf, &indexes)
-		if err == nil {
-			indexes[vv.FileIndex] = struct{}{}
-			buf, err = json.Marshal(indexes)
-			if err == nil {
-				tdb.Set("Viewed", vv.Hash, buf)
+	}
+	if err != nil {
+		log.TLogln("Error set viewed:", err)
+	}
+}
+
+// SetPosition marks file as viewed and saves playback position.
+// Missing seconds or offset are calculated from file length and duration.
+func SetPosition(vv *Viewed) {
+	muViewed.Lock()
+	defer muViewed.Unlock()
+	indexes, err := getViewed(vv.Hash)
+	if err == nil {
+		pos := indexes[vv.FileIndex]
+		if pos == nil {
+			pos = &viewedPos{}
+			indexes[vv.FileIndex] = pos
+		}
+		if vv.Length > 0 {
+			pos.Length = vv.Length
+		}
+		if vv.Duration > 0 {
+			pos.Duration = vv.Duration
+		}
+		pos.Offset = vv.Offset
+		pos.Seconds = vv.Seconds
+		if pos.Length > 0 && pos.Duration > 0 {
+			if pos.Seconds == 0 && pos.Offset > 0 {
+				pos.Seconds = float64(pos.Offset) / float64(pos.Length) * pos.Duration
+			} else if pos.Offset == 0 && pos.Seconds > 0 {
+				pos.Offset = int64(pos.Seconds / pos.Duration * float64(pos.Length))
 			}
 		}
+		pos.Updated = time.Now().Unix()
+		err = putViewed(vv.Hash, indexes)
 	}
 	if err != nil {
-		log.TLogln("Error set viewed:", err)
+		log.TLogln("Error set position:", err)
 	}
 }
 
+// GetPosition returns saved position of file or nil if position not saved
+func GetPosition(hash string, index int) *Viewed {
+	indexes, err := getViewed(hash)
+	if err != nil {
+		log.TLogln("Error get position:", err)
+		return nil
+	}
+	if pos, ok := indexes[index]; ok && pos != nil && pos.Updated > 0 {
+		return toViewed(hash, index, pos)
+	}
+	return nil
+}
+
+// LastPosition returns last updated position in torrent or nil if no positions saved
+func LastPosition(hash string) *Viewed {
+	indexes, err := getViewed(hash)
+	if err != nil {
+		log.TLogln("Error get position:", err)
+		return nil
+	}
+	var last *Viewed
+	for i, pos := range indexes {
+		if pos == nil || pos.Updated == 0 {
+			continue
+		}
+		if last == nil || pos.Updated > last.Updated {
+			last = toViewed(hash, i, pos)
+		}
+	}
+	return last
+}
+
 func RemViewed(vv *Viewed) {
-	buf := tdb.Get("Viewed", vv.Hash)
-	var indeces map[int]struct{}
-	err := json.Unmarshal(buf, &indeces)
+	muViewed.Lock()
+	defer muViewed.Unlock()
+	indexes, err := getViewed(vv.Hash)
 	if err == nil {
 		if vv.FileIndex != -1 {
-			delete(indeces, vv.FileIndex)
-			buf, err = json.Marshal(indeces)
-			if err == nil {
-				tdb.Set("Viewed", vv.Hash, buf)
-			}
+			delete(indexes, vv.FileIndex)
+			err = putViewed(vv.Hash, indexes)
 		} else {
 			tdb.Rem("Viewed", vv.Hash)
 		}
@@ -61,16 +162,15 @@ func RemViewed(vv *Viewed) {
 func ListViewed(hash string) []*Viewed {
 	var err error
 	if hash != "" {
-		buf := tdb.Get("Viewed", hash)
-		if len(buf) == 0 {
-			return []*Viewed{}
-		}
-		var indeces map[int]struct{}
-		err = json.Unmarshal(buf, &indeces)
+		var indexes map[int]*viewedPos
+		indexes, err = getViewed(hash)
 		if err == nil {
 			var ret []*Viewed
-			for i := range indeces {
-				ret = append(ret, &Viewed{hash, i})
+			for i, pos := range indexes {
+				ret = append(ret, toViewed(hash, i, pos))
+			}
+			if ret == nil {
+				return []*Viewed{}
 			}
 			return ret
 		}
@@ -78,15 +178,11 @@ func ListViewed(hash string) []*Viewed {
 		var ret []*Viewed
 		keys := tdb.List("Viewed")
 		for _, key := range keys {
-			buf := tdb.Get("Viewed", key)
-			if len(buf) == 0 {
-				return []*Viewed{}
-			}
-			var indeces map[int]struct{}
-			err = json.Unmarshal(buf, &indeces)
+			var indexes map[int]*viewedPos
+			indexes, err = getViewed(key)
 			if err == nil {
-				for i := range indeces {
-					ret = append(ret, &Viewed{key, i})
+				for i, pos := range indexes {
+					ret = append(ret, toViewed(key, i, pos))
 				}
 			}
 		}
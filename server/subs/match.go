@@ -0,0 +1,102 @@
+package subs
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	mt "server/mimetype"
+	"server/torr/state"
+)
+
+// Sidecar is subtitles file of torrent paired with video file
+type Sidecar struct {
+	*state.TorrentFileStat
+	Language string // ISO 639-2 code from file name suffix, empty if unknown
+	exact    bool
+}
+
+// languages maps file name suffixes to ISO 639-2 codes
+var languages = map[string]string{
+	"en": "eng", "eng": "eng", "english": "eng",
+	"ru": "rus", "rus": "rus", "russian": "rus", "рус": "rus", "русский": "rus",
+	"uk": "ukr", "ua": "ukr", "ukr": "ukr", "ukrainian": "ukr", "укр": "ukr",
+	"be": "bel", "bel": "bel", "belarusian": "bel",
+	"de": "ger", "ger": "ger", "deu": "ger", "german": "ger",
+	"fr": "fre", "fre": "fre", "fra": "fre", "french": "fre",
+	"es": "spa", "spa": "spa", "spanish": "spa",
+	"it": "ita", "ita": "ita", "italian": "ita",
+	"pt": "por", "por": "por", "portuguese": "por",
+	"pl": "pol", "pol": "pol", "polish": "pol",
+	"cs": "cze", "cze": "cze", "ces": "cze", "czech": "cze",
+	"nl": "dut", "dut": "dut", "nld": "dut", "dutch": "dut",
+	"tr": "tur", "tur": "tur", "turkish": "tur",
+	"ja": "jpn", "jpn": "jpn", "japanese": "jpn",
+	"ko": "kor", "kor": "kor", "korean": "kor",
+	"zh": "chi", "chi": "chi", "zho": "chi", "chinese": "chi",
+	"ar": "ara", "ara": "ara", "arabic": "ara",
+	"he": "heb", "heb": "heb", "hebrew": "heb",
+	"kk": "kaz", "kaz": "kaz", "kazakh": "kaz",
+}
+
+func stem(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// language returns language code of subtitles file name suffix like
+// Movie.en.srt, Movie_rus.forced.srt or Subs/2_English.srt
+func language(suffix string) string {
+	tokens := strings.FieldsFunc(strings.ToLower(suffix), func(r rune) bool {
+		return r == '.' || r == '_' || r == '-' || r == ' ' || r == '[' || r == ']' || r == '(' || r == ')'
+	})
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if lang, ok := languages[tokens[i]]; ok {
+			return lang
+		}
+	}
+	return ""
+}
+
+// isSeparator reports if c separates video name from suffix of subtitles file name,
+// so Episode 1.mkv isn't paired with Episode 10.srt
+func isSeparator(c byte) bool {
+	return c == '.' || c == '_' || c == '-' || c == ' '
+}
+
+// MatchSidecars returns subtitles files of torrent for video file: files named as video
+// with optional language suffix, files in folders named as video and, if torrent has
+// only one video, all subtitles files
+func MatchSidecars(files []*state.TorrentFileStat, video *state.TorrentFileStat) []*Sidecar {
+	videoStem := strings.ToLower(stem(video.Path))
+	videos := 0
+	for _, f := range files {
+		if mime, err := mt.MimeTypeByPath(f.Path); err == nil && mime.IsVideo() {
+			videos++
+		}
+	}
+
+	var ret []*Sidecar
+	for _, f := range files {
+		if f == video || !IsSub(f.Path) {
+			continue
+		}
+		subStem := strings.ToLower(stem(f.Path))
+		dir := strings.ToLower(filepath.Base(filepath.Dir(f.Path)))
+		switch {
+		case subStem == videoStem:
+			ret = append(ret, &Sidecar{TorrentFileStat: f, exact: true})
+		case strings.HasPrefix(subStem, videoStem) && isSeparator(subStem[len(videoStem)]):
+			ret = append(ret, &Sidecar{TorrentFileStat: f, Language: language(subStem[len(videoStem):])})
+		case dir == videoStem || videos == 1:
+			ret = append(ret, &Sidecar{TorrentFileStat: f, Language: language(subStem)})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].exact != ret[j].exact {
+			return ret[i].exact
+		}
+		return ret[i].Path < ret[j].Path
+	})
+	return ret
+}
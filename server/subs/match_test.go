@@ -0,0 +1,83 @@
+package subs
+
+import (
+	"testing"
+
+	"server/torr/state"
+)
+
+func TestMatchSidecars(t *testing.T) {
+	type match struct {
+		path     string
+		language string
+	}
+	tests := []struct {
+		name  string
+		files []string
+		video string
+		want  []match
+	}{
+		{
+			name:  "exact and language suffix",
+			files: []string{"Movie.mkv", "Movie.srt", "Movie.en.srt", "Movie_rus.forced.ass", "Other.mkv", "Other.srt"},
+			video: "Movie.mkv",
+			want:  []match{{"Movie.srt", ""}, {"Movie.en.srt", "eng"}, {"Movie_rus.forced.ass", "rus"}},
+		},
+		{
+			name:  "episode number prefix",
+			files: []string{"Episode 1.mkv", "Episode 10.mkv", "Episode 1.srt", "Episode 10.srt", "Episode 1-ua.srt"},
+			video: "Episode 1.mkv",
+			want:  []match{{"Episode 1.srt", ""}, {"Episode 1-ua.srt", "ukr"}},
+		},
+		{
+			name:  "longer episode",
+			files: []string{"Episode 1.mkv", "Episode 10.mkv", "Episode 1.srt", "Episode 10.srt"},
+			video: "Episode 10.mkv",
+			want:  []match{{"Episode 10.srt", ""}},
+		},
+		{
+			name:  "folder named as video",
+			files: []string{"Show/Movie.mkv", "Show/Second.mkv", "Show/Subs/Movie/2_English.srt", "Show/Subs/Second/2_English.srt"},
+			video: "Show/Movie.mkv",
+			want:  []match{{"Show/Subs/Movie/2_English.srt", "eng"}},
+		},
+		{
+			name:  "single video",
+			files: []string{"Film/film.avi", "Film/Subs/rus.srt"},
+			video: "Film/film.avi",
+			want:  []match{{"Film/Subs/rus.srt", "rus"}},
+		},
+		{
+			name:  "no subtitles",
+			files: []string{"Episode 1.mkv", "Episode 2.mkv", "Episode 2.srt"},
+			video: "Episode 1.mkv",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []*state.TorrentFileStat
+			var video *state.TorrentFileStat
+			for i, path := range tt.files {
+				f := &state.TorrentFileStat{Id: i + 1, Path: path}
+				files = append(files, f)
+				if path == tt.video {
+					video = f
+				}
+			}
+			got := MatchSidecars(files, video)
+			if len(got) != len(tt.want) {
+				paths := make([]string, 0, len(got))
+				for _, s := range got {
+					paths = append(paths, s.Path)
+				}
+				t.Fatalf("got %d sidecars %v, want %d", len(got), paths, len(tt.want))
+			}
+			for i, w := range tt.want {
+				if got[i].Path != w.path || got[i].Language != w.language {
+					t.Errorf("sidecar %d = %q (%q), want %q (%q)", i, got[i].Path, got[i].Language, w.path, w.language)
+				}
+			}
+		})
+	}
+}
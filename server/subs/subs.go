@@ -0,0 +1,310 @@
+package subs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/ffprobe"
+	mt "server/mimetype"
+	"server/settings"
+	"server/torr"
+	"server/torr/state"
+)
+
+// Track is text subtitles track of video file, embedded in it or sidecar file of torrent
+type Track struct {
+	Id       int
+	Embedded bool
+	Stream   int    `json:",omitempty"` // stream index in video file of embedded track
+	FileId   int    `json:",omitempty"` // torrent file id of sidecar track
+	Path     string `json:",omitempty"`
+	Codec    string
+	Language string `json:",omitempty"`
+	Title    string `json:",omitempty"`
+	Default  bool
+}
+
+const maxSubSize = 16 << 20
+
+// text subtitles codecs of ffprobe, bitmap subtitles can't be converted
+var textCodecs = []string{"subrip", "srt", "ass", "ssa", "webvtt", "mov_text", "text"}
+
+var cacheDir = filepath.Join(os.TempDir(), "torrserver-subs")
+
+// IsSub reports if file is subtitles file
+func IsSub(path string) bool {
+	mime, err := mt.MimeTypeByPath(path)
+	return err == nil && mime.IsSub()
+}
+
+func key(hash string, fileID int) string {
+	return strings.ToLower(hash) + "_" + strconv.Itoa(fileID)
+}
+
+// List returns subtitles tracks of video file, embedded tracks are probed by ffprobe
+// if probe is set, otherwise only tracks probed before are returned
+func List(hash string, files []*state.TorrentFileStat, fileID int, probe bool) []*Track {
+	var video *state.TorrentFileStat
+	for _, f := range files {
+		if f.Id == fileID {
+			video = f
+			break
+		}
+	}
+	if video == nil {
+		return nil
+	}
+
+	tracks := make([]*Track, 0)
+	for _, f := range MatchSidecars(files, video) {
+		tracks = append(tracks, &Track{
+			FileId:   f.Id,
+			Path:     f.Path,
+			Codec:    strings.TrimPrefix(strings.ToLower(filepath.Ext(f.Path)), "."),
+			Language: f.Language,
+		})
+	}
+	tracks = append(tracks, embeddedTracks(hash, fileID, probe)...)
+	for i, t := range tracks {
+		t.Id = i + 1
+	}
+	return tracks
+}
+
+func embeddedTracks(hash string, fileID int, probe bool) []*Track {
+	info, err := torr.GetMediaInfo(hash, fileID, probe && ffprobe.Exists())
+	if err != nil || info == nil {
+		return nil
+	}
+	list := make([]*Track, 0)
+	for _, s := range info.Subtitles {
+		if !slices.Contains(textCodecs, s.Codec) {
+			continue
+		}
+		list = append(list, &Track{
+			Embedded: true,
+			Stream:   s.Index,
+			Codec:    s.Codec,
+			Language: s.Language,
+			Title:    s.Title,
+			Default:  s.Default,
+		})
+	}
+	return list
+}
+
+// Get returns subtitles track converted to format: vtt or srt
+func Get(tor *torr.Torrent, fileID int, track *Track, format string) ([]byte, error) {
+	if format != "vtt" && format != "srt" {
+		return nil, errors.New("wrong subtitles format")
+	}
+	if track.Embedded {
+		return extract(tor.Hash().HexString(), fileID, track, format)
+	}
+
+	buf, err := tor.ReadFile(track.FileId, maxSubSize)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case track.Codec == format:
+		return buf, nil
+	case track.Codec == "srt" && format == "vtt":
+		return SrtToVtt(buf), nil
+	}
+	return convert(bytes.NewReader(buf), "pipe:0", format)
+}
+
+// ErrPending is returned while embedded track is extracted in background, request should be retried
+var ErrPending = errors.New("subtitles are being extracted")
+
+const (
+	extractWait  = 15 * time.Second // request waits for extract before ErrPending
+	failedTTL    = 10 * time.Minute // failed extract isn't started again for this time
+	maxCacheSize = 64 << 20
+	maxCacheAge  = 7 * 24 * time.Hour
+)
+
+type extractJob struct {
+	done   chan struct{}
+	err    error
+	failed time.Time
+}
+
+var (
+	jobs       = make(map[string]*extractJob)
+	muJobs     sync.Mutex
+	extractSem = make(chan struct{}, 2) // ffmpeg reads whole video file, so extracts are limited
+)
+
+// extract converts embedded track of video file and keeps it in temp dir.
+// ffmpeg reads whole video file to extract track, so it runs in background
+// and ErrPending is returned if it isn't done in short time.
+func extract(hash string, fileID int, track *Track, format string) ([]byte, error) {
+	name := filepath.Join(cacheDir, key(hash, fileID)+"_"+strconv.Itoa(track.Stream)+"."+format)
+	if buf, err := os.ReadFile(name); err == nil {
+		return buf, nil
+	}
+
+	muJobs.Lock()
+	job, ok := jobs[name]
+	if ok && !job.failed.IsZero() && time.Since(job.failed) > failedTTL {
+		ok = false
+	}
+	if !ok {
+		job = &extractJob{done: make(chan struct{})}
+		jobs[name] = job
+		go runExtract(job, name, torr.LocalPlayLink(hash, fileID), format, track.Stream)
+	}
+	muJobs.Unlock()
+
+	select {
+	case <-job.done:
+		if job.err != nil {
+			return nil, job.err
+		}
+		return os.ReadFile(name)
+	case <-time.After(extractWait):
+		return nil, ErrPending
+	}
+}
+
+func runExtract(job *extractJob, name, link, format string, stream int) {
+	extractSem <- struct{}{}
+	buf, err := convert(nil, link, format, "-map", "0:"+strconv.Itoa(stream))
+	<-extractSem
+	if err == nil {
+		if err = os.MkdirAll(cacheDir, 0o777); err == nil {
+			err = os.WriteFile(name, buf, 0o666)
+		}
+		evictCache()
+	}
+	muJobs.Lock()
+	if err != nil {
+		job.err = err
+		job.failed = time.Now()
+	} else {
+		delete(jobs, name)
+	}
+	muJobs.Unlock()
+	close(job.done)
+}
+
+// evictCache removes extracted tracks older than max age and the oldest ones over max size
+func evictCache() {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		name string
+		size int64
+		mod  time.Time
+	}
+	files := make([]cached, 0, len(entries))
+	var total int64
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		name := filepath.Join(cacheDir, e.Name())
+		if time.Since(fi.ModTime()) > maxCacheAge {
+			os.Remove(name)
+			continue
+		}
+		files = append(files, cached{name, fi.Size(), fi.ModTime()})
+		total += fi.Size()
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].mod.Before(files[j].mod)
+	})
+	for _, f := range files {
+		if total <= maxCacheSize {
+			break
+		}
+		os.Remove(f.name)
+		total -= f.size
+	}
+}
+
+func convert(stdin *bytes.Reader, input, format string, opts ...string) ([]byte, error) {
+	if !ffprobe.FFmpegExists() {
+		return nil, errors.New("ffmpeg not found")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	muxer := "webvtt"
+	if format == "srt" {
+		muxer = "srt"
+	}
+	args := append([]string{"-i", input}, opts...)
+	args = append(args, "-f", muxer, "pipe:1")
+	cmd := ffprobe.FFmpeg(ctx, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	buf, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// SrtToVtt converts SubRip subtitles to WebVTT
+func SrtToVtt(buf []byte) []byte {
+	buf = bytes.TrimPrefix(buf, []byte("\xef\xbb\xbf"))
+	buf = bytes.ReplaceAll(buf, []byte("\r\n"), []byte("\n"))
+	var ret bytes.Buffer
+	ret.WriteString("WEBVTT\n\n")
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.Contains(line, "-->") {
+			line = strings.ReplaceAll(line, ",", ".")
+		}
+		ret.WriteString(line + "\n")
+	}
+	return ret.Bytes()
+}
+
+// Label returns title of track for players
+func (t *Track) Label() string {
+	label := t.Title
+	if t.Language != "" {
+		if label != "" {
+			label = t.Language + " - " + label
+		} else {
+			label = t.Language
+		}
+	}
+	if label == "" && t.Path != "" {
+		label = filepath.Base(t.Path)
+	}
+	if label == "" {
+		label = "Track " + strconv.Itoa(t.Id)
+	}
+	return label
+}
+
+// Path returns path of subtitles track link without leading slash, signed if auth enabled
+func Path(hash string, fileID, trackID int, format string) string {
+	path := "subs/" + hash + "/" + strconv.Itoa(fileID) + "/" + strconv.Itoa(trackID) + "." + format
+	if settings.HttpAuth {
+		path += "?" + settings.StreamToken(hash, fileID)
+	}
+	return path
+}
@@ -63,7 +63,7 @@ func files(c tele.Context) error {
 			i := len(txt)
 			for _, f := range ti.FileStats {
 				btn := filesKbd.Data("#"+strconv.Itoa(f.Id)+": "+humanize.Bytes(uint64(f.Length))+"\n"+filepath.Base(f.Path), "upload", ti.Hash, strconv.Itoa(f.Id))
-				link := filesKbd.URL("Ссылка", host+"/stream/"+filepath.Base(f.Path)+"?link="+t.Hash().HexString()+"&index="+strconv.Itoa(f.Id)+"&play")
+				link := filesKbd.URL("Ссылка", host+"/stream/"+filepath.Base(f.Path)+"?link="+t.Hash().HexString()+"&index="+strconv.Itoa(f.Id)+"&play"+settings.StreamLinkToken(ti.Hash, f.Id))
 				files = append(files, filesKbd.Row(btn, link))
 				if i+len(txt) > 1024 || len(files) > 99 {
 					filesKbd := &tele.ReplyMarkup{}
@@ -0,0 +1,260 @@
+package thumbs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/ffprobe"
+	"server/log"
+	"server/settings"
+	"server/torr"
+)
+
+const (
+	thumbWidth   = 320
+	spriteWidth  = 160
+	spriteHeight = 90
+	MaxFrames    = 20
+	failedTTL    = 10 * time.Minute
+	// background thumbnails are made one by one with pause, they load pieces of torrents
+	queueSize  = 100
+	queuePause = 5 * time.Second
+)
+
+type fileLock struct {
+	sync.Mutex
+	refs int
+}
+
+var (
+	locks   = make(map[string]*fileLock)
+	failed  = make(map[string]time.Time) // images ffmpeg failed on, not created again for failedTTL
+	muLocks sync.Mutex
+	// limits concurrent ffmpeg runs, each reads video from torrent
+	workers = make(chan struct{}, 2)
+
+	queue     = make(chan queued, queueSize)
+	queuedSet = make(map[queued]bool) // files in queue, guarded by muLocks
+	queueOnce sync.Once
+)
+
+type queued struct {
+	hash   string
+	fileID int
+}
+
+func validHash(hash string) bool {
+	buf, err := hex.DecodeString(hash)
+	return err == nil && len(buf) == 20
+}
+
+func thumbsDir() string {
+	return filepath.Join(settings.Path, "thumbs")
+}
+
+func fileName(hash string, fileID, frames int) string {
+	name := strconv.Itoa(fileID)
+	if frames > 0 {
+		name += "_sprite" + strconv.Itoa(frames)
+	}
+	return filepath.Join(thumbsDir(), strings.ToLower(hash), name+".jpg")
+}
+
+// lock locks image name while it is created, unlock removes lock nobody waits for
+func lock(name string) {
+	muLocks.Lock()
+	l, ok := locks[name]
+	if !ok {
+		l = new(fileLock)
+		locks[name] = l
+	}
+	l.refs++
+	muLocks.Unlock()
+	l.Lock()
+}
+
+func unlock(name string) {
+	muLocks.Lock()
+	l := locks[name]
+	l.refs--
+	if l.refs == 0 {
+		delete(locks, name)
+	}
+	muLocks.Unlock()
+	l.Unlock()
+}
+
+// isFailed reports if ffmpeg failed to create image recently
+func isFailed(name string) bool {
+	muLocks.Lock()
+	defer muLocks.Unlock()
+	tm, ok := failed[name]
+	if ok && time.Since(tm) > failedTTL {
+		delete(failed, name)
+		return false
+	}
+	return ok
+}
+
+func setFailed(name string) {
+	muLocks.Lock()
+	defer muLocks.Unlock()
+	failed[name] = time.Now()
+}
+
+// Exists reports if thumbnail of video file was created
+func Exists(hash string, fileID int) bool {
+	if !validHash(hash) {
+		return false
+	}
+	_, err := os.Stat(fileName(hash, fileID, 0))
+	return err == nil
+}
+
+// Get returns path of thumbnail of video file, or of sprite of frames if frames > 0,
+// image is generated by ffmpeg on first request and kept in thumbs dir
+func Get(hash string, fileID, frames int) (string, error) {
+	if !validHash(hash) {
+		return "", errors.New("wrong hash")
+	}
+	if frames > MaxFrames {
+		frames = MaxFrames
+	}
+	name := fileName(hash, fileID, frames)
+	lock(name)
+	defer unlock(name)
+
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	if isFailed(name) {
+		return "", errors.New("thumbnail can't be created")
+	}
+	if !ffprobe.FFmpegExists() {
+		return "", errors.New("ffmpeg not found")
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o777); err != nil {
+		return "", err
+	}
+
+	workers <- struct{}{}
+	defer func() { <-workers }()
+
+	link := torr.LocalPlayLink(hash, fileID)
+	duration := 0.0
+	if data, err := ffprobe.ProbeUrl(link); err == nil {
+		duration = data.Format.DurationSeconds
+	}
+
+	var args []string
+	if frames > 0 {
+		args = spriteArgs(link, duration, frames)
+	} else {
+		pos := 30.0
+		if duration > 0 {
+			pos = duration / 10
+		}
+		args = []string{
+			"-ss", fmt.Sprintf("%.2f", pos), "-i", link,
+			"-frames:v", "1", "-vf", "scale=" + strconv.Itoa(thumbWidth) + ":-2",
+		}
+	}
+	args = append(args, "-q:v", "4", "-f", "image2", "-y", name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cmd := ffprobe.FFmpeg(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(name)
+		setFailed(name)
+		log.TLogln("Error create thumbnail:", hash, fileID, err, strings.TrimSpace(stderr.String()))
+		return "", err
+	}
+	return name, nil
+}
+
+// Queue queues creation of thumbnail of video file in background, files are skipped
+// if thumbnail exists, ffmpeg failed on it recently or queue is full
+func Queue(hash string, fileID int) {
+	if !validHash(hash) || !ffprobe.FFmpegExists() || Exists(hash, fileID) || isFailed(fileName(hash, fileID, 0)) {
+		return
+	}
+	queueOnce.Do(func() {
+		go makeQueued()
+	})
+	q := queued{strings.ToLower(hash), fileID}
+	muLocks.Lock()
+	defer muLocks.Unlock()
+	if queuedSet[q] {
+		return
+	}
+	select {
+	case queue <- q:
+		queuedSet[q] = true
+	default:
+	}
+}
+
+func makeQueued() {
+	for q := range queue {
+		muLocks.Lock()
+		delete(queuedSet, q)
+		muLocks.Unlock()
+		if torr.GetTorrent(q.hash) == nil {
+			continue
+		}
+		Get(q.hash, q.fileID, 0)
+		time.Sleep(queuePause)
+	}
+}
+
+// spriteArgs returns ffmpeg args of row of frames, each frame is read from its own position
+func spriteArgs(link string, duration float64, frames int) []string {
+	if duration <= 0 {
+		duration = float64(frames+1) * 60
+	}
+	args := make([]string, 0)
+	filter := ""
+	stack := ""
+	for i := 0; i < frames; i++ {
+		pos := duration * float64(i+1) / float64(frames+1)
+		args = append(args, "-ss", fmt.Sprintf("%.2f", pos), "-i", link)
+		filter += fmt.Sprintf("[%d:v]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1[f%d];",
+			i, spriteWidth, spriteHeight, spriteWidth, spriteHeight, i)
+		stack += fmt.Sprintf("[f%d]", i)
+	}
+	if frames > 1 {
+		filter += stack + "hstack=inputs=" + strconv.Itoa(frames) + "[out]"
+	} else {
+		filter += "[f0]null[out]"
+	}
+	return append(args, "-filter_complex", filter, "-map", "[out]", "-frames:v", "1")
+}
+
+// Remove removes thumbnails of torrent
+func Remove(hash string) {
+	if !validHash(hash) {
+		return
+	}
+	os.RemoveAll(filepath.Join(thumbsDir(), strings.ToLower(hash)))
+}
+
+// Path returns path of thumbnail link without leading slash, signed if auth enabled
+func Path(hash string, fileID int) string {
+	path := "thumb/" + hash + "/" + strconv.Itoa(fileID)
+	if settings.HttpAuth {
+		path += "?" + settings.StreamToken(hash, fileID)
+	}
+	return path
+}
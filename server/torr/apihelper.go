@@ -1,10 +1,12 @@
 package torr
 
 import (
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/anacrolix/torrent"
@@ -12,6 +14,8 @@ import (
 
 	"server/log"
 	sets "server/settings"
+	cacheSt "server/torr/storage/state"
+	"server/torr/storage/torrstor"
 )
 
 var bts *BTServer
@@ -24,7 +28,7 @@ func LoadTorrent(tor *Torrent) *Torrent {
 	if tor.TorrentSpec == nil {
 		return nil
 	}
-	tr, err := NewTorrent(tor.TorrentSpec, bts)
+	tr, err := NewTorrent(tor.TorrentSpec, tor.Category, bts)
 	if err != nil {
 		return nil
 	}
@@ -38,14 +42,17 @@ func LoadTorrent(tor *Torrent) *Torrent {
 }
 
 func AddTorrent(spec *torrent.TorrentSpec, title, poster string, data string, category string) (*Torrent, error) {
-	torr, err := NewTorrent(spec, bts)
+	torDB := GetTorrentDB(spec.InfoHash)
+	if category == "" && torDB != nil {
+		category = torDB.Category
+	}
+
+	torr, err := NewTorrent(spec, category, bts)
 	if err != nil {
 		log.TLogln("error add torrent:", err)
 		return nil, err
 	}
 
-	torDB := GetTorrentDB(spec.InfoHash)
-
 	if torr.Title == "" {
 		torr.Title = title
 		if title == "" && torDB != nil {
@@ -103,7 +110,7 @@ func GetTorrent(hashHex string) *Torrent {
 		tor = tr
 		go func() {
 			log.TLogln("New torrent", tor.Hash())
-			tr, _ := NewTorrent(tor.TorrentSpec, bts)
+			tr, _ := NewTorrent(tor.TorrentSpec, tor.Category, bts)
 			if tr != nil {
 				tr.Title = tor.Title
 				tr.Poster = tor.Poster
@@ -159,6 +166,78 @@ func SetTorrent(hashHex, title, poster, category string, data string) *Torrent {
 	}
 }
 
+// SetKeep enables or disables full download of torrent to TorrentsSavePath,
+// torrent is saved to db and reloaded with new storage
+func SetKeep(hashHex string, keep bool) error {
+	if sets.ReadOnly {
+		return errors.New("read-only DB mode")
+	}
+	if keep && sets.BTsets.TorrentsSavePath == "" {
+		return errors.New("torrents save path is not set")
+	}
+	hash := metainfo.NewHashFromHex(hashHex)
+	tor := bts.GetTorrent(hash)
+	if tor == nil {
+		tor = GetTorrentDB(hash)
+	}
+	if tor == nil {
+		return errors.New("torrent not found")
+	}
+	tor.Keep = keep
+	AddTorrentDB(tor)
+	if bts.RemoveTorrent(hash) {
+		log.TLogln("reload torrent with keep:", keep, hashHex)
+	}
+	if keep {
+		GetTorrent(hashHex)
+	}
+	return nil
+}
+
+// SetTags sets user tags of torrent, empty and repeated tags are removed
+func SetTags(hashHex string, tags []string) error {
+	if sets.ReadOnly {
+		return errors.New("read-only DB mode")
+	}
+	hash := metainfo.NewHashFromHex(hashHex)
+	tor := bts.GetTorrent(hash)
+	torDb := GetTorrentDB(hash)
+	if tor == nil && torDb == nil {
+		return errors.New("torrent not found")
+	}
+
+	var list []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !seen[strings.ToLower(tag)] {
+			seen[strings.ToLower(tag)] = true
+			list = append(list, tag)
+		}
+	}
+
+	if tor != nil {
+		tor.Tags = list
+	}
+	if torDb != nil {
+		torDb.Tags = list
+		AddTorrentDB(torDb)
+	}
+	return nil
+}
+
+// resumeKeepTorrents loads keep torrents from db to continue download
+func resumeKeepTorrents() {
+	if sets.BTsets.TorrentsSavePath == "" {
+		return
+	}
+	for _, db := range sets.ListTorrent() {
+		if db.Keep {
+			GetTorrent(db.InfoHash.HexString())
+		}
+	}
+}
+
 func RemTorrent(hashHex string) {
 	if sets.ReadOnly {
 		log.TLogln("API RemTorrent: Read-only DB mode!", hashHex)
@@ -178,7 +257,11 @@ func RemTorrent(hashHex string) {
 			}
 		}
 	}
+	if sets.BTsets.TorrentsSavePath != "" {
+		os.Remove(torrstor.KeepCompletionPath(hash))
+	}
 	removeStreamLinkDir(hashHex)
+	removeMediaInfo(hashHex)
 	RemTorrentDB(hash)
 }
 
@@ -213,21 +296,28 @@ func DropTorrent(hashHex string) {
 	bts.RemoveTorrent(hash)
 }
 
-func SetSettings(set *sets.BTSets) {
+// SetSettings saves settings and applies them, BT client is restarted
+// only if changed settings can't be applied in place
+func SetSettings(set *sets.BTSets) *SettingsResult {
 	if sets.ReadOnly {
 		log.TLogln("API SetSettings: Read-only DB mode!")
-		return
+		return nil
 	}
+	old := *sets.BTsets
 	sets.SetBTSets(set)
-	log.TLogln("drop all torrents")
-	dropAllTorrent()
-	time.Sleep(time.Second * 1)
-	log.TLogln("disconect")
-	bts.Disconnect()
-	log.TLogln("connect")
-	bts.Connect()
-	time.Sleep(time.Second * 1)
+	res := diffSettings(&old, sets.BTsets)
+	if len(res.Restart) > 0 {
+		log.TLogln("settings changed:", res.Changed, "restart BT client for:", res.Restart)
+		reconnect()
+	} else {
+		log.TLogln("settings changed:", res.Changed)
+		applySettings(res)
+	}
+	if len(res.ServerRestart) > 0 {
+		log.TLogln("restart server to apply settings:", res.ServerRestart)
+	}
 	log.TLogln("end set settings")
+	return res
 }
 
 func SetDefSettings() {
@@ -236,14 +326,7 @@ func SetDefSettings() {
 		return
 	}
 	sets.SetDefaultConfig()
-	log.TLogln("drop all torrents")
-	dropAllTorrent()
-	time.Sleep(time.Second * 1)
-	log.TLogln("disconect")
-	bts.Disconnect()
-	log.TLogln("connect")
-	bts.Connect()
-	time.Sleep(time.Second * 1)
+	reconnect()
 	log.TLogln("end set default settings")
 }
 
@@ -261,19 +344,27 @@ func Shutdown() {
 	os.Exit(0)
 }
 
+func DiskCacheState() *cacheSt.DiskCacheState {
+	return bts.storage.DiskUsage()
+}
+
 func WriteStatus(w io.Writer) {
 	bts.client.WriteStatus(w)
 }
 
 func Preload(torr *Torrent, index int) {
-	cache := float32(sets.BTsets.CacheSize)
-	preload := float32(sets.BTsets.PreloadCache)
+	policy := torr.policy
+	if policy == nil {
+		policy = sets.GetPolicy(torr.Hash().HexString(), torr.Category)
+	}
+	cache := float32(policy.CacheSize)
+	preload := float32(policy.PreloadCache)
 	size := int64((cache / 100.0) * preload)
 	if size <= 0 {
 		return
 	}
-	if size > sets.BTsets.CacheSize {
-		size = sets.BTsets.CacheSize
+	if size > policy.CacheSize {
+		size = policy.CacheSize
 	}
 	torr.Preload(index, size)
 }
@@ -0,0 +1,145 @@
+package torr
+
+import (
+	"reflect"
+	"slices"
+	"time"
+
+	"server/log"
+	sets "server/settings"
+)
+
+// SettingsResult describes settings changed by SetSettings
+type SettingsResult struct {
+	Changed       []string // names of changed settings
+	Restart       []string // names of changed settings applied by restart of BT client
+	ServerRestart []string // names of changed settings applied only after restart of server
+}
+
+// Has reports if one of settings was changed
+func (r *SettingsResult) Has(names ...string) bool {
+	if r == nil {
+		return false
+	}
+	for _, n := range names {
+		if slices.Contains(r.Changed, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// restartSets are settings used only on configure of BT client or on add of torrents,
+// torrents are added again after restart of BT client
+var restartSets = []string{
+	"UseDisk",
+	"TorrentsSavePath",
+	"ForceEncrypt",
+	"EnableDebug",
+	"EnableIPv6",
+	"DisableTCP",
+	"DisableUTP",
+	"DisableUPNP",
+	"DisableDHT",
+	"DisablePEX",
+	"DisableUpload",
+	"PeersListenPort",
+}
+
+// serverRestartSets are settings used only on start of web server
+var serverRestartSets = []string{
+	"SslPort",
+	"SslCert",
+	"SslKey",
+}
+
+// policySets are settings of torrent policy, applied to loaded torrents in place
+var policySets = []string{
+	"CacheSize",
+	"ReaderReadAHead",
+	"PreloadCache",
+	"ConnectionsLimit",
+	"TorrentPolicies",
+}
+
+func diffSettings(old, cur *sets.BTSets) *SettingsResult {
+	res := &SettingsResult{Changed: []string{}, Restart: []string{}, ServerRestart: []string{}}
+	if old == nil || cur == nil {
+		return res
+	}
+	vo := reflect.ValueOf(old).Elem()
+	vc := reflect.ValueOf(cur).Elem()
+	for i := 0; i < vo.NumField(); i++ {
+		name := vo.Type().Field(i).Name
+		if reflect.DeepEqual(vo.Field(i).Interface(), vc.Field(i).Interface()) {
+			continue
+		}
+		res.Changed = append(res.Changed, name)
+		if slices.Contains(restartSets, name) {
+			res.Restart = append(res.Restart, name)
+		}
+		if slices.Contains(serverRestartSets, name) {
+			res.ServerRestart = append(res.ServerRestart, name)
+		}
+	}
+	return res
+}
+
+// applySettings applies changed settings to connected BT client and loaded torrents
+func applySettings(res *SettingsResult) {
+	if res.Has("DownloadRateLimit", "UploadRateLimit", "RateSchedules") {
+		bts.ApplyRateLimits()
+	}
+	if res.Has("RetrackersMode") {
+		for _, t := range bts.ListTorrents() {
+			t.applyRetrackers()
+		}
+	}
+	if res.Has(policySets...) {
+		// config of BT client isn't changed after it is created, new torrents get connections limit from policy
+		bts.storage.SetCapacity(sets.BTsets.CacheSize)
+		for _, t := range bts.ListTorrents() {
+			t.applyPolicy(sets.GetPolicy(t.Hash().HexString(), t.Category))
+		}
+	}
+}
+
+// applyPolicy changes policy of loaded torrent
+func (t *Torrent) applyPolicy(policy *sets.TorrentPolicy) {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	t.policy = policy
+	if t.cache != nil {
+		t.cache.SetPolicy(policy)
+		t.cache.SetCapacity(policy.CacheSize)
+	}
+	if t.Torrent != nil && policy.ConnectionsLimit > 0 {
+		t.Torrent.SetMaxEstablishedConns(policy.ConnectionsLimit)
+	}
+}
+
+// applyRetrackers adds trackers of current retrackers mode to loaded torrent. BT client
+// can't stop announce to trackers of running torrent, so removed trackers are used
+// until torrent is closed, torrents added later get trackers of new mode.
+func (t *Torrent) applyRetrackers() {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if t.Torrent == nil || t.TorrentSpec == nil {
+		return
+	}
+	if trackers := retrackers(t.TorrentSpec.Trackers); len(trackers) > 0 {
+		t.Torrent.AddTrackers(trackers)
+	}
+}
+
+// reconnect drops all torrents and restarts BT client with current settings
+func reconnect() {
+	log.TLogln("drop all torrents")
+	dropAllTorrent()
+	time.Sleep(time.Second * 1)
+	log.TLogln("disconect")
+	bts.Disconnect()
+	log.TLogln("connect")
+	bts.Connect()
+	time.Sleep(time.Second * 1)
+}
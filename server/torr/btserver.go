@@ -7,11 +7,13 @@ import (
 	"maps"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/anacrolix/publicip"
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/wlynxg/anet"
+	"golang.org/x/time/rate"
 
 	"server/settings"
 	"server/torr/storage/torrstor"
@@ -27,6 +29,12 @@ type BTServer struct {
 
 	torrents map[metainfo.Hash]*Torrent
 
+	dlLimiter *rate.Limiter
+	ulLimiter *rate.Limiter
+	schedule  string
+	muRates   sync.Mutex // guards limiters and schedule, rates are applied by API and by timer
+	stopRates chan struct{}
+
 	mu sync.Mutex
 }
 
@@ -65,12 +73,21 @@ func (bt *BTServer) Connect() error {
 	bt.client, err = torrent.NewClient(bt.config)
 	bt.torrents = make(map[metainfo.Hash]*Torrent)
 	InitApiHelper(bt)
+	if err == nil {
+		go resumeKeepTorrents()
+		bt.stopRates = make(chan struct{})
+		go bt.watchRateLimits(bt.stopRates)
+	}
 	return err
 }
 
 func (bt *BTServer) Disconnect() {
 	bt.mu.Lock()
 	defer bt.mu.Unlock()
+	if bt.stopRates != nil {
+		close(bt.stopRates)
+		bt.stopRates = nil
+	}
 	if bt.client != nil {
 		bt.client.Close()
 		bt.client = nil
@@ -117,12 +134,15 @@ func (bt *BTServer) configure(ctx context.Context) {
 	// 	RequirePreferred: settings.BTsets.ForceEncrypt, //	NE
 	// 	Preferred:        true,                         //	NE
 	// } //	NE
-	if settings.BTsets.DownloadRateLimit > 0 {
-		bt.config.DownloadRateLimiter = utils.Limit(settings.BTsets.DownloadRateLimit * 1024)
-	}
-	if settings.BTsets.UploadRateLimit > 0 {
-		bt.config.UploadRateLimiter = utils.Limit(settings.BTsets.UploadRateLimit * 1024)
-	}
+	// limiters are always set to change rate limits by schedule without reconnect
+	dl, ul, schedule := settings.GetRateLimits(time.Now())
+	bt.muRates.Lock()
+	bt.dlLimiter = utils.Limit(dl * 1024)
+	bt.ulLimiter = utils.Limit(ul * 1024)
+	bt.schedule = schedule
+	bt.config.DownloadRateLimiter = bt.dlLimiter
+	bt.config.UploadRateLimiter = bt.ulLimiter
+	bt.muRates.Unlock()
 	if settings.TorAddr != "" {
 		log.Println("Set listen addr", settings.TorAddr)
 		bt.config.SetListenAddr(settings.TorAddr)
@@ -179,6 +199,39 @@ func (bt *BTServer) configure(ctx context.Context) {
 	}
 }
 
+// ApplyRateLimits sets rate limits of active schedule or global rate limits to client
+func (bt *BTServer) ApplyRateLimits() {
+	bt.muRates.Lock()
+	defer bt.muRates.Unlock()
+	if bt.dlLimiter == nil || bt.ulLimiter == nil {
+		return
+	}
+	dl, ul, schedule := settings.GetRateLimits(time.Now())
+	if schedule != bt.schedule {
+		if schedule != "" {
+			log.Println("Rate limits schedule:", schedule, "download:", dl, "upload:", ul)
+		} else {
+			log.Println("Rate limits schedule ended, download:", dl, "upload:", ul)
+		}
+		bt.schedule = schedule
+	}
+	utils.SetLimit(bt.dlLimiter, dl*1024)
+	utils.SetLimit(bt.ulLimiter, ul*1024)
+}
+
+func (bt *BTServer) watchRateLimits(stop chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			bt.ApplyRateLimits()
+		}
+	}
+}
+
 func (bt *BTServer) GetTorrent(hash torrent.InfoHash) *Torrent {
 	if torr, ok := bt.torrents[hash]; ok {
 		return torr
@@ -19,8 +19,18 @@ type tsFiles struct {
 func AddTorrentDB(torr *Torrent) {
 	t := new(settings.TorrentDB)
 	t.TorrentSpec = torr.TorrentSpec
+	// save info of magnet torrent, it is needed to export torrent file and gets info without peers,
+	// spec is copied as it is used by working torrent
+	if t.TorrentSpec != nil && len(t.TorrentSpec.InfoBytes) == 0 && torr.Torrent != nil && torr.Torrent.Info() != nil {
+		spec := *t.TorrentSpec
+		spec.InfoBytes = torr.Torrent.Metainfo().InfoBytes
+		t.TorrentSpec = &spec
+	}
 	t.Title = torr.Title
 	t.Category = torr.Category
+	t.Keep = torr.Keep
+	t.Tags = torr.Tags
+	t.FilePriorities = torr.filePriorities()
 	if torr.Data == "" {
 		files := new(tsFiles)
 		files.TorrServer.Files = torr.Status().FileStats
@@ -57,6 +67,9 @@ func GetTorrentDB(hash metainfo.Hash) *Torrent {
 			torr.Timestamp = db.Timestamp
 			torr.Size = db.Size
 			torr.Data = db.Data
+			torr.Keep = db.Keep
+			torr.Tags = db.Tags
+			torr.FilePriorities = db.FilePriorities
 			torr.Stat = state.TorrentInDB
 			return torr
 		}
@@ -80,8 +93,20 @@ func ListTorrentsDB() map[metainfo.Hash]*Torrent {
 		torr.Timestamp = db.Timestamp
 		torr.Size = db.Size
 		torr.Data = db.Data
+		torr.Keep = db.Keep
+		torr.Tags = db.Tags
+		torr.FilePriorities = db.FilePriorities
 		torr.Stat = state.TorrentInDB
 		ret[torr.TorrentSpec.InfoHash] = torr
 	}
 	return ret
 }
+
+// DataFiles returns files of torrent saved in data on add to DB
+func DataFiles(data string) []*state.TorrentFileStat {
+	files := new(tsFiles)
+	if err := json.Unmarshal([]byte(data), files); err != nil {
+		return nil
+	}
+	return files.TorrServer.Files
+}
@@ -0,0 +1,200 @@
+package torr
+
+import (
+	"sync"
+
+	"server/torr/state"
+)
+
+// TorrentEvent contains changed fields of torrent status since previous event
+type TorrentEvent struct {
+	Hash    string         `json:"hash"`
+	Changes map[string]any `json:"changes"`
+}
+
+type torrentSnapshot struct {
+	Stat             state.TorrentStat
+	DownloadSpeed    float64
+	UploadSpeed      float64
+	ActivePeers      int
+	TotalPeers       int
+	HalfOpenPeers    int
+	ConnectedSeeders int
+	LoadedSize       int64
+	PreloadedBytes   int64
+	PreloadSize      int64
+	CacheFilled      int64
+	CacheCapacity    int64
+}
+
+// diff returns changed fields, all fields if prev is nil
+func (s *torrentSnapshot) diff(prev *torrentSnapshot) map[string]any {
+	if prev == nil {
+		prev = &torrentSnapshot{Stat: -1, DownloadSpeed: -1, UploadSpeed: -1, ActivePeers: -1, TotalPeers: -1, HalfOpenPeers: -1,
+			ConnectedSeeders: -1, LoadedSize: -1, PreloadedBytes: -1, PreloadSize: -1, CacheFilled: -1, CacheCapacity: -1}
+	}
+	ch := map[string]any{}
+	if s.Stat != prev.Stat {
+		ch["stat"] = s.Stat
+		ch["stat_string"] = s.Stat.String()
+	}
+	if s.DownloadSpeed != prev.DownloadSpeed {
+		ch["download_speed"] = s.DownloadSpeed
+	}
+	if s.UploadSpeed != prev.UploadSpeed {
+		ch["upload_speed"] = s.UploadSpeed
+	}
+	if s.ActivePeers != prev.ActivePeers {
+		ch["active_peers"] = s.ActivePeers
+	}
+	if s.TotalPeers != prev.TotalPeers {
+		ch["total_peers"] = s.TotalPeers
+	}
+	if s.HalfOpenPeers != prev.HalfOpenPeers {
+		ch["half_open_peers"] = s.HalfOpenPeers
+	}
+	if s.ConnectedSeeders != prev.ConnectedSeeders {
+		ch["connected_seeders"] = s.ConnectedSeeders
+	}
+	if s.LoadedSize != prev.LoadedSize {
+		ch["loaded_size"] = s.LoadedSize
+	}
+	if s.PreloadedBytes != prev.PreloadedBytes {
+		ch["preloaded_bytes"] = s.PreloadedBytes
+	}
+	if s.PreloadSize != prev.PreloadSize {
+		ch["preload_size"] = s.PreloadSize
+	}
+	if s.CacheFilled != prev.CacheFilled {
+		ch["cache_filled"] = s.CacheFilled
+	}
+	if s.CacheCapacity != prev.CacheCapacity {
+		ch["cache_capacity"] = s.CacheCapacity
+	}
+	return ch
+}
+
+// Subscriber receives torrent events, all torrents if hashes is empty
+type Subscriber struct {
+	C      chan *TorrentEvent
+	hashes map[string]struct{}
+	// last snapshots sent to subscriber, changes are sent against them
+	last   map[string]*torrentSnapshot
+	muLast sync.Mutex
+}
+
+func (s *Subscriber) accept(hash string) bool {
+	if len(s.hashes) == 0 {
+		return true
+	}
+	_, ok := s.hashes[hash]
+	return ok
+}
+
+// send sends changes since last snapshot sent to subscriber, if event is dropped
+// for slow subscriber next event of torrent has full state
+func (s *Subscriber) send(hash string, snap *torrentSnapshot) {
+	s.muLast.Lock()
+	defer s.muLast.Unlock()
+	changes := snap.diff(s.last[hash])
+	if len(changes) == 0 {
+		return
+	}
+	select {
+	case s.C <- &TorrentEvent{Hash: hash, Changes: changes}:
+		s.last[hash] = snap
+	default:
+		delete(s.last, hash)
+	}
+}
+
+var (
+	subscribers   = make(map[*Subscriber]struct{})
+	muSubscribers sync.RWMutex
+)
+
+// Subscribe registers new subscriber and sends it current state of active torrents
+func Subscribe(hashes []string) *Subscriber {
+	s := &Subscriber{
+		C:      make(chan *TorrentEvent, 64),
+		hashes: make(map[string]struct{}),
+		last:   make(map[string]*torrentSnapshot),
+	}
+	for _, h := range hashes {
+		if h != "" {
+			s.hashes[h] = struct{}{}
+		}
+	}
+
+	if bts != nil {
+		for _, t := range bts.ListTorrents() {
+			hash := t.Hash().HexString()
+			if !s.accept(hash) {
+				continue
+			}
+			s.send(hash, t.snapshot())
+		}
+	}
+
+	muSubscribers.Lock()
+	subscribers[s] = struct{}{}
+	muSubscribers.Unlock()
+	return s
+}
+
+func Unsubscribe(s *Subscriber) {
+	muSubscribers.Lock()
+	delete(subscribers, s)
+	muSubscribers.Unlock()
+}
+
+func hasSubscribers() bool {
+	muSubscribers.RLock()
+	defer muSubscribers.RUnlock()
+	return len(subscribers) > 0
+}
+
+func publishEvent(hash string, snap *torrentSnapshot) {
+	muSubscribers.RLock()
+	defer muSubscribers.RUnlock()
+	for s := range subscribers {
+		if s.accept(hash) {
+			s.send(hash, snap)
+		}
+	}
+}
+
+func (t *Torrent) snapshot() *torrentSnapshot {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	snap := &torrentSnapshot{
+		Stat:           t.Stat,
+		DownloadSpeed:  t.DownloadSpeed,
+		UploadSpeed:    t.UploadSpeed,
+		PreloadedBytes: t.PreloadedBytes,
+		PreloadSize:    t.PreloadSize,
+	}
+	if t.Torrent != nil {
+		st := t.Torrent.Stats()
+		snap.ActivePeers = st.ActivePeers
+		snap.TotalPeers = st.TotalPeers
+		snap.HalfOpenPeers = st.HalfOpenPeers
+		snap.ConnectedSeeders = st.ConnectedSeeders
+		if t.Torrent.Info() != nil {
+			snap.LoadedSize = t.Torrent.BytesCompleted()
+		}
+	}
+	if t.cache != nil {
+		snap.CacheFilled = t.cache.GetState().Filled
+		snap.CacheCapacity = t.cache.GetCapacity()
+	}
+	return snap
+}
+
+// sendEvent publishes changes of torrent status to subscribers
+func (t *Torrent) sendEvent() {
+	if !hasSubscribers() {
+		return
+	}
+	publishEvent(t.Hash().HexString(), t.snapshot())
+}
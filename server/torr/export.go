@@ -0,0 +1,37 @@
+package torr
+
+import (
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"server/version"
+)
+
+// MetaInfo returns metainfo of torrent file with info and current trackers of torrent,
+// nil if info of torrent is not loaded and not saved in DB
+func (t *Torrent) MetaInfo() *metainfo.MetaInfo {
+	mi := new(metainfo.MetaInfo)
+	if t.Torrent != nil && t.Torrent.Info() != nil {
+		*mi = t.Torrent.Metainfo()
+	} else if t.TorrentSpec != nil && len(t.TorrentSpec.InfoBytes) > 0 {
+		mi.InfoBytes = t.TorrentSpec.InfoBytes
+	} else {
+		return nil
+	}
+	if len(mi.AnnounceList) == 0 && t.TorrentSpec != nil {
+		for _, tier := range t.TorrentSpec.Trackers {
+			if len(tier) > 0 {
+				mi.AnnounceList = append(mi.AnnounceList, tier)
+			}
+		}
+	}
+	if mi.Announce == "" && len(mi.AnnounceList) > 0 {
+		mi.Announce = mi.AnnounceList[0][0]
+	}
+	mi.CreatedBy = "TorrServer " + version.Version
+	if mi.CreationDate == 0 {
+		mi.CreationDate = time.Now().Unix()
+	}
+	return mi
+}
@@ -0,0 +1,205 @@
+package torr
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"server/ffprobe"
+	"server/log"
+	sets "server/settings"
+	"server/torr/state"
+)
+
+var (
+	mediaInfos  = make(map[string]map[int]*state.MediaInfo)
+	muMediaInfo sync.Mutex
+	probeLocks  = make(map[string]*probeLock)
+)
+
+type probeLock struct {
+	sync.Mutex
+	refs int
+}
+
+// cachedMediaInfos returns media info of files of torrent probed before by file id,
+// media info of torrent is loaded from DB once
+func cachedMediaInfos(hash string) map[int]*state.MediaInfo {
+	hash = strings.ToLower(hash)
+	muMediaInfo.Lock()
+	defer muMediaInfo.Unlock()
+	list, ok := mediaInfos[hash]
+	if !ok {
+		list = sets.ListMediaInfo(hash)
+		mediaInfos[hash] = list
+	}
+	ret := make(map[int]*state.MediaInfo, len(list))
+	for id, info := range list {
+		ret[id] = info
+	}
+	return ret
+}
+
+// cachedMediaInfo returns media info of file of torrent probed before
+func cachedMediaInfo(hash string, fileID int) *state.MediaInfo {
+	hash = strings.ToLower(hash)
+	muMediaInfo.Lock()
+	defer muMediaInfo.Unlock()
+	list, ok := mediaInfos[hash]
+	if !ok {
+		list = sets.ListMediaInfo(hash)
+		mediaInfos[hash] = list
+	}
+	return list[fileID]
+}
+
+// lockProbe locks probe of file, unlockProbe removes lock nobody waits for
+func lockProbe(key string) {
+	muMediaInfo.Lock()
+	l, ok := probeLocks[key]
+	if !ok {
+		l = new(probeLock)
+		probeLocks[key] = l
+	}
+	l.refs++
+	muMediaInfo.Unlock()
+	l.Lock()
+}
+
+func unlockProbe(key string) {
+	muMediaInfo.Lock()
+	l := probeLocks[key]
+	l.refs--
+	if l.refs == 0 {
+		delete(probeLocks, key)
+	}
+	muMediaInfo.Unlock()
+	l.Unlock()
+}
+
+// GetMediaInfo returns media info of file of torrent, file is probed by ffprobe
+// if probe is set and it wasn't probed before, result is kept in DB
+func GetMediaInfo(hash string, fileID int, probe bool) (*state.MediaInfo, error) {
+	hash = strings.ToLower(hash)
+	key := hash + "/" + strconv.Itoa(fileID)
+	lockProbe(key)
+	defer unlockProbe(key)
+
+	info := cachedMediaInfo(hash, fileID)
+	if info != nil || !probe {
+		return info, nil
+	}
+	if !ffprobe.Exists() {
+		return nil, errors.New("ffprobe not found")
+	}
+
+	data, err := ffprobe.ProbeLink(LocalPlayLink(hash, fileID))
+	if err != nil {
+		log.TLogln("Error probe media info:", hash, fileID, err)
+		return nil, err
+	}
+	info = NewMediaInfo(data)
+	muMediaInfo.Lock()
+	if list, ok := mediaInfos[hash]; ok {
+		list[fileID] = info
+	}
+	muMediaInfo.Unlock()
+	sets.SetMediaInfo(hash, fileID, info)
+	return info, nil
+}
+
+// removeMediaInfo removes media info of files of torrent from memory and DB
+func removeMediaInfo(hash string) {
+	hash = strings.ToLower(hash)
+	muMediaInfo.Lock()
+	delete(mediaInfos, hash)
+	muMediaInfo.Unlock()
+	sets.RemMediaInfo(hash)
+}
+
+// NewMediaInfo normalizes ffprobe output
+func NewMediaInfo(data *ffprobe.Probe) *state.MediaInfo {
+	info := new(state.MediaInfo)
+	if data.Format != nil {
+		info.Duration, _ = strconv.ParseFloat(data.Format.Duration, 64)
+		info.BitRate, _ = strconv.ParseInt(data.Format.BitRate, 10, 64)
+		info.Container = data.Format.FormatName
+	}
+	for _, s := range data.Streams {
+		switch s.CodecType {
+		case "video":
+			// skip cover images of mkv and mp4
+			if info.Video != nil || s.Disposition["attached_pic"] == 1 {
+				continue
+			}
+			info.Video = &state.VideoTrack{
+				Index:     s.Index,
+				Codec:     s.CodecName,
+				Profile:   s.Profile,
+				Width:     s.Width,
+				Height:    s.Height,
+				FrameRate: frameRate(s.AvgFrameRate),
+				HDR:       hdr(s),
+			}
+		case "audio":
+			info.Audio = append(info.Audio, &state.AudioTrack{
+				Index:         s.Index,
+				Codec:         s.CodecName,
+				Language:      s.Tags["language"],
+				Title:         s.Tags["title"],
+				Channels:      s.Channels,
+				ChannelLayout: s.ChannelLayout,
+				Default:       s.Disposition["default"] == 1,
+			})
+		case "subtitle":
+			info.Subtitles = append(info.Subtitles, &state.SubtitleTrack{
+				Index:    s.Index,
+				Codec:    s.CodecName,
+				Language: s.Tags["language"],
+				Title:    s.Tags["title"],
+				Default:  s.Disposition["default"] == 1,
+				Forced:   s.Disposition["forced"] == 1,
+			})
+		}
+	}
+	for _, c := range data.Chapters {
+		ch := &state.Chapter{Title: c.Tags["title"]}
+		ch.Start, _ = strconv.ParseFloat(c.StartTime, 64)
+		ch.End, _ = strconv.ParseFloat(c.EndTime, 64)
+		info.Chapters = append(info.Chapters, ch)
+	}
+	return info
+}
+
+// frameRate parses ffprobe rate like 24000/1001
+func frameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func hdr(s *ffprobe.ProbeStream) string {
+	for _, sd := range s.SideDataList {
+		if t, _ := sd["side_data_type"].(string); strings.HasPrefix(t, "DOVI") {
+			return "Dolby Vision"
+		}
+	}
+	switch s.ColorTransfer {
+	case "smpte2084":
+		return "HDR10"
+	case "arib-std-b67":
+		return "HLG"
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package torr
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	sets "server/settings"
+	"server/torr/state"
+	cacheSt "server/torr/storage/state"
+	"server/torr/storage/torrstor"
+)
+
+var (
+	streamRequestsTotal atomic.Int64
+	streamBytesTotal    atomic.Int64
+)
+
+type torrentMetrics struct {
+	labels         string
+	status         *state.TorrentStatus
+	cache          *cacheSt.CacheState
+	readers        int
+	streamRequests int64
+	streamBytes    int64
+}
+
+type metricFamily struct {
+	name  string
+	help  string
+	typ   string
+	value func(m *torrentMetrics) float64
+}
+
+var torrentFamilies = []metricFamily{
+	{"torrserver_torrent_download_speed_bytes", "Torrent download speed in bytes per second.", "gauge",
+		func(m *torrentMetrics) float64 { return m.status.DownloadSpeed }},
+	{"torrserver_torrent_upload_speed_bytes", "Torrent upload speed in bytes per second.", "gauge",
+		func(m *torrentMetrics) float64 { return m.status.UploadSpeed }},
+	{"torrserver_torrent_peers_active", "Active peers of torrent.", "gauge",
+		func(m *torrentMetrics) float64 { return float64(m.status.ActivePeers) }},
+	{"torrserver_torrent_peers_total", "Known peers of torrent.", "gauge",
+		func(m *torrentMetrics) float64 { return float64(m.status.TotalPeers) }},
+	{"torrserver_torrent_peers_half_open", "Half-open peer connections of torrent.", "gauge",
+		func(m *torrentMetrics) float64 { return float64(m.status.HalfOpenPeers) }},
+	{"torrserver_torrent_seeders_connected", "Connected seeders of torrent.", "gauge",
+		func(m *torrentMetrics) float64 { return float64(m.status.ConnectedSeeders) }},
+	{"torrserver_torrent_size_bytes", "Torrent size in bytes.", "gauge",
+		func(m *torrentMetrics) float64 { return float64(m.status.TorrentSize) }},
+	{"torrserver_torrent_loaded_bytes", "Completed bytes of torrent.", "gauge",
+		func(m *torrentMetrics) float64 { return float64(m.status.LoadedSize) }},
+	{"torrserver_torrent_read_bytes_total", "Bytes read from peers.", "counter",
+		func(m *torrentMetrics) float64 { return float64(m.status.BytesRead) }},
+	{"torrserver_torrent_written_bytes_total", "Bytes written to peers.", "counter",
+		func(m *torrentMetrics) float64 { return float64(m.status.BytesWritten) }},
+	{"torrserver_torrent_pieces_dirtied_good_total", "Pieces passed hash check.", "counter",
+		func(m *torrentMetrics) float64 { return float64(m.status.PiecesDirtiedGood) }},
+	{"torrserver_torrent_pieces_dirtied_bad_total", "Pieces failed hash check.", "counter",
+		func(m *torrentMetrics) float64 { return float64(m.status.PiecesDirtiedBad) }},
+	{"torrserver_cache_filled_bytes", "Bytes stored in torrent cache.", "gauge",
+		func(m *torrentMetrics) float64 { return float64(m.cache.Filled) }},
+	{"torrserver_cache_capacity_bytes", "Torrent cache capacity in bytes.", "gauge",
+		func(m *torrentMetrics) float64 { return float64(m.cache.Capacity) }},
+	{"torrserver_cache_readers", "Active readers of torrent cache.", "gauge",
+		func(m *torrentMetrics) float64 { return float64(m.readers) }},
+	{"torrserver_torrent_stream_requests_total", "Stream requests of torrent.", "counter",
+		func(m *torrentMetrics) float64 { return float64(m.streamRequests) }},
+	{"torrserver_torrent_stream_bytes_total", "Bytes streamed from torrent.", "counter",
+		func(m *torrentMetrics) float64 { return float64(m.streamBytes) }},
+}
+
+// streamReader counts bytes streamed from torrent as they are read
+type streamReader struct {
+	*torrstor.Reader
+	t *Torrent
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.t.streamBytes.Add(int64(n))
+		streamBytesTotal.Add(int64(n))
+	}
+	return n, err
+}
+
+// WriteMetrics writes metrics of active torrents in Prometheus text format
+func WriteMetrics(w io.Writer) {
+	var list []*torrentMetrics
+	var torrents map[metainfo.Hash]*Torrent
+	if bts != nil {
+		torrents = bts.ListTorrents()
+	}
+	for _, t := range torrents {
+		st := t.StatsStatus()
+		m := &torrentMetrics{
+			labels:         fmt.Sprintf(`{hash="%s",title="%s"}`, st.Hash, escapeLabel(st.Title)),
+			status:         st,
+			cache:          &cacheSt.CacheState{},
+			streamRequests: t.streamRequests.Load(),
+			streamBytes:    t.streamBytes.Load(),
+		}
+		if cache := t.GetCache(); cache != nil && t.Torrent != nil && t.Torrent.Info() != nil {
+			m.cache = cache.GetState()
+			m.readers = cache.Readers()
+		}
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].status.Hash < list[j].status.Hash
+	})
+
+	writeMetric(w, "torrserver_torrents_active", "Active torrents.", "gauge", float64(len(list)))
+	writeMetric(w, "torrserver_stream_requests_total", "Stream requests.", "counter", float64(streamRequestsTotal.Load()))
+	writeMetric(w, "torrserver_stream_bytes_total", "Bytes streamed.", "counter", float64(streamBytesTotal.Load()))
+	writeMetric(w, "torrserver_cache_size_bytes", "Cache size setting in bytes.", "gauge", float64(sets.BTsets.CacheSize))
+
+	if len(list) == 0 {
+		return
+	}
+	for _, f := range torrentFamilies {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		for _, m := range list {
+			fmt.Fprintf(w, "%s%s %v\n", f.name, m.labels, f.value(m))
+		}
+	}
+}
+
+func writeMetric(w io.Writer, name, help, typ string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, value)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
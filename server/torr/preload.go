@@ -49,6 +49,10 @@ func (t *Torrent) Preload(index int, size int64) {
 		}
 	}()
 
+	if t.FileSkipped(index) {
+		log.TLogln("Skip preload of skipped file:", index)
+		return
+	}
 	file := t.findFileIndex(index)
 	if file == nil {
 		file = t.Files()[0]
@@ -73,15 +77,12 @@ func (t *Torrent) Preload(index int, size int64) {
 			}
 		}()
 
-		if ffprobe.Exists() {
-			link := "http://127.0.0.1:" + settings.Port + "/play/" + t.Hash().HexString() + "/" + strconv.Itoa(index)
-			if settings.Ssl {
-				link = "https://127.0.0.1:" + settings.SslPort + "/play/" + t.Hash().HexString() + "/" + strconv.Itoa(index)
-			}
-			if data, err := ffprobe.ProbeUrl(link); err == nil {
-				t.BitRate = data.Format.BitRate
-				t.DurationSeconds = data.Format.DurationSeconds
+		if info, err := GetMediaInfo(t.Hash().HexString(), index, ffprobe.Exists()); err == nil && info != nil {
+			// empty if unknown, like before probe
+			if info.BitRate > 0 {
+				t.BitRate = strconv.FormatInt(info.BitRate, 10)
 			}
+			t.DurationSeconds = info.Duration
 		}
 
 		if t.Stat == state.TorrentClosed {
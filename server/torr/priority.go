@@ -0,0 +1,147 @@
+package torr
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+
+	sets "server/settings"
+	utils2 "server/utils"
+)
+
+// sortedFiles returns files of torrent in order of file ids of status
+func (t *Torrent) sortedFiles() []*torrent.File {
+	files := t.Files()
+	sort.Slice(files, func(i, j int) bool {
+		return utils2.CompareStrings(files[i].Path(), files[j].Path())
+	})
+	return files
+}
+
+// filePriorities returns download priorities of files by file id, map must not be changed
+func (t *Torrent) filePriorities() map[int]string {
+	t.muPrio.Lock()
+	defer t.muPrio.Unlock()
+	return t.FilePriorities
+}
+
+func (t *Torrent) setFilePriorities(prio map[int]string) {
+	t.muPrio.Lock()
+	defer t.muPrio.Unlock()
+	t.FilePriorities = prio
+}
+
+// filePriority returns download priority of file, empty for normal priority
+func (t *Torrent) filePriority(fileID int) string {
+	return t.filePriorities()[fileID]
+}
+
+// FileSkipped reports if file is excluded from download
+func (t *Torrent) FileSkipped(fileID int) bool {
+	return t.filePriority(fileID) == sets.FilePrioritySkip
+}
+
+// filePiecePriorities returns download priorities of files by path for keep download
+func (t *Torrent) filePiecePriorities() map[string]string {
+	ret := make(map[string]string)
+	if len(t.filePriorities()) == 0 {
+		return ret
+	}
+	for i, f := range t.sortedFiles() {
+		if prio := t.filePriority(i + 1); prio != "" {
+			ret[f.Path()] = prio
+		}
+	}
+	return ret
+}
+
+// skippedSize returns size of files excluded from download
+func (t *Torrent) skippedSize() int64 {
+	size := int64(0)
+	if len(t.filePriorities()) == 0 {
+		return size
+	}
+	for i, f := range t.sortedFiles() {
+		if t.FileSkipped(i + 1) {
+			size += f.Length()
+		}
+	}
+	return size
+}
+
+// keepMissing returns bytes left to download of keep torrent, skipped files are not counted
+func (t *Torrent) keepMissing() int64 {
+	if len(t.filePriorities()) == 0 {
+		return t.Torrent.BytesMissing()
+	}
+	missing := int64(0)
+	for i, f := range t.sortedFiles() {
+		if t.FileSkipped(i + 1) {
+			continue
+		}
+		for _, ps := range f.State() {
+			if !ps.Complete {
+				missing += ps.Bytes
+			}
+		}
+	}
+	return missing
+}
+
+// SetFilePriority sets download priority of files of torrent: skip, normal or high.
+// Skipped files are not preloaded and downloaded by keep, high priority files are downloaded by keep first
+func SetFilePriority(hashHex string, fileIDs []int, priority string) error {
+	if sets.ReadOnly {
+		return errors.New("read-only DB mode")
+	}
+	switch priority {
+	case sets.FilePrioritySkip, sets.FilePriorityNormal, sets.FilePriorityHigh:
+	default:
+		return errors.New("wrong priority")
+	}
+	if len(fileIDs) == 0 {
+		return errors.New("files are empty")
+	}
+	hash := metainfo.NewHashFromHex(hashHex)
+	tor := bts.GetTorrent(hash)
+	torDb := GetTorrentDB(hash)
+	if tor == nil && torDb == nil {
+		return errors.New("torrent not found")
+	}
+
+	// map is replaced, not changed
+	prio := make(map[int]string)
+	if tor != nil {
+		for id, p := range tor.filePriorities() {
+			prio[id] = p
+		}
+	} else {
+		for id, p := range torDb.FilePriorities {
+			prio[id] = p
+		}
+	}
+	for _, id := range fileIDs {
+		if priority == sets.FilePriorityNormal {
+			delete(prio, id)
+		} else {
+			prio[id] = priority
+		}
+	}
+	if len(prio) == 0 {
+		prio = nil
+	}
+
+	if tor != nil {
+		tor.setFilePriorities(prio)
+		if tor.cache != nil && tor.Torrent != nil && tor.Torrent.Info() != nil {
+			tor.cache.SetFilePriorities(tor.filePiecePriorities())
+		}
+	}
+	if torDb != nil {
+		torDb.FilePriorities = prio
+		AddTorrentDB(torDb)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package state
+
+// Episode is info of series episode parsed from file path
+type Episode struct {
+	Show       string `json:"show,omitempty"`
+	Season     int    `json:"season,omitempty"`
+	Episode    int    `json:"episode,omitempty"`
+	Year       int    `json:"year,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+}
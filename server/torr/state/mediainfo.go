@@ -0,0 +1,47 @@
+package state
+
+// MediaInfo is normalized ffprobe info of media file
+type MediaInfo struct {
+	Duration  float64          `json:"duration,omitempty"` // in seconds
+	BitRate   int64            `json:"bit_rate,omitempty"` // in bit/s
+	Container string           `json:"container,omitempty"`
+	Video     *VideoTrack      `json:"video,omitempty"`
+	Audio     []*AudioTrack    `json:"audio,omitempty"`
+	Subtitles []*SubtitleTrack `json:"subtitles,omitempty"`
+	Chapters  []*Chapter       `json:"chapters,omitempty"`
+}
+
+type VideoTrack struct {
+	Index     int     `json:"index"`
+	Codec     string  `json:"codec,omitempty"`
+	Profile   string  `json:"profile,omitempty"`
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	FrameRate float64 `json:"frame_rate,omitempty"`
+	HDR       string  `json:"hdr,omitempty"` // HDR10, HLG, Dolby Vision
+}
+
+type AudioTrack struct {
+	Index         int    `json:"index"`
+	Codec         string `json:"codec,omitempty"`
+	Language      string `json:"language,omitempty"`
+	Title         string `json:"title,omitempty"`
+	Channels      int    `json:"channels,omitempty"`
+	ChannelLayout string `json:"channel_layout,omitempty"`
+	Default       bool   `json:"default,omitempty"`
+}
+
+type SubtitleTrack struct {
+	Index    int    `json:"index"`
+	Codec    string `json:"codec,omitempty"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+	Forced   bool   `json:"forced,omitempty"`
+}
+
+type Chapter struct {
+	Start float64 `json:"start"` // in seconds
+	End   float64 `json:"end"`   // in seconds
+	Title string  `json:"title,omitempty"`
+}
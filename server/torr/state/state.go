@@ -64,12 +64,18 @@ type TorrentStatus struct {
 	PiecesDirtiedBad    int64       `json:"pieces_dirtied_bad,omitempty"`
 	DurationSeconds     float64     `json:"duration_seconds,omitempty"`
 	BitRate             string      `json:"bit_rate,omitempty"`
+	Keep                bool        `json:"keep,omitempty"`
+	KeepProgress        float64     `json:"keep_progress,omitempty"` // in percent
+	Tags                []string    `json:"tags,omitempty"`
 
 	FileStats []*TorrentFileStat `json:"file_stats,omitempty"`
 }
 
 type TorrentFileStat struct {
-	Id     int    `json:"id,omitempty"`
-	Path   string `json:"path,omitempty"`
-	Length int64  `json:"length,omitempty"`
+	Id        int        `json:"id,omitempty"`
+	Path      string     `json:"path,omitempty"`
+	Length    int64      `json:"length,omitempty"`
+	MediaInfo *MediaInfo `json:"media_info,omitempty"`
+	Episode   *Episode   `json:"episode,omitempty"`
+	Priority  string     `json:"priority,omitempty"` // skip or high, empty is normal
 }
@@ -15,6 +15,14 @@ type CacheState struct {
 	Readers      []*ReaderState
 }
 
+// DiskCacheState is usage of disk cache of all torrents
+type DiskCacheState struct {
+	Used   int64
+	Quota  int64 // 0 - no limit
+	Free   int64
+	Caches int
+}
+
 type ItemState struct {
 	Id        int
 	Length    int64
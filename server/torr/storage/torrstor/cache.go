@@ -1,6 +1,7 @@
 package torrstor
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"sort"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
 )
 
 type Cache struct {
@@ -37,7 +39,24 @@ type Cache struct {
 	isRemove bool
 	isClosed bool
 	muRemove sync.Mutex
-	torrent  *torrent.Torrent
+
+	torrent   *torrent.Torrent
+	verified  []int // pieces checked in background before torrent was set
+	muTorrent sync.Mutex
+
+	policy    *settings.TorrentPolicy
+	dlLimiter *rate.Limiter
+
+	length     int64
+	isKeep     bool
+	keep       *keepFiles
+	completion *pieceCompletion
+	verifyStop chan struct{} // closed by Close to stop check of pieces
+	verifyDone chan struct{} // closed when check of pieces is finished
+
+	filePrio   map[string]string // download priorities of files by path
+	piecePrio  map[int]string    // download priorities of pieces by priorities of their files
+	muFilePrio sync.Mutex
 }
 
 func NewCache(capacity int64, storage *Storage) *Cache {
@@ -61,22 +80,268 @@ func (c *Cache) Init(info *metainfo.Info, hash metainfo.Hash) {
 	c.pieceLength = info.PieceLength
 	c.pieceCount = info.NumPieces()
 	c.hash = hash
+	c.length = info.TotalLength()
+
+	if c.isKeep {
+		if settings.BTsets.TorrentsSavePath != "" {
+			c.keep = newKeepFiles(settings.BTsets.TorrentsSavePath, hash, info)
+			c.completion = newPieceCompletion(KeepCompletionPath(hash), c.pieceCount)
+		} else {
+			log.TLogln("Keep torrent requires torrents save path:", hash.HexString())
+		}
+	}
 
-	if settings.BTsets.UseDisk {
+	if settings.BTsets.UseDisk && c.keep == nil {
 		name := filepath.Join(settings.BTsets.TorrentsSavePath, hash.HexString())
 		err := os.MkdirAll(name, 0o777)
 		if err != nil {
 			log.TLogln("Error create dir:", err)
 		}
+		c.completion = newPieceCompletion(filepath.Join(name, completionName), c.pieceCount)
 	}
 
 	for i := 0; i < c.pieceCount; i++ {
 		c.pieces[i] = NewPiece(i, c)
 	}
+
+	if c.completion != nil {
+		// loaded pieces are incomplete until hash is checked in background,
+		// open of torrent isn't delayed by reading of whole cache
+		var pieces []*Piece
+		for i := 0; i < c.pieceCount; i++ {
+			if p := c.pieces[i]; p.Complete && (p.kPiece != nil || p.dPiece != nil) {
+				p.Complete = false
+				pieces = append(pieces, p)
+			}
+		}
+		if len(pieces) > 0 {
+			c.verifyStop = make(chan struct{})
+			c.verifyDone = make(chan struct{})
+			go c.verifyPieces(info, pieces)
+		}
+	}
+}
+
+// verifyPieces checks hash of pieces loaded from disk cache or keep files,
+// pieces are taken from Init so the map of cache isn't read after Close
+func (c *Cache) verifyPieces(info *metainfo.Info, pieces []*Piece) {
+	defer close(c.verifyDone)
+	complete, bad := 0, 0
+	for _, p := range pieces {
+		select {
+		case <-c.verifyStop:
+			return
+		default:
+		}
+		i := p.Id
+		if p.Complete {
+			// downloaded again while waiting for check
+			continue
+		}
+		hash := info.Piece(i).Hash()
+		if p.kPiece != nil && !p.kPiece.Verify(hash) {
+			bad++
+			p.kPiece.Release()
+			continue
+		}
+		if p.dPiece != nil && !p.dPiece.Verify(hash) {
+			bad++
+			p.dPiece.Release()
+			continue
+		}
+		complete++
+		p.Complete = true
+		c.muTorrent.Lock()
+		torr := c.torrent
+		if torr == nil {
+			c.verified = append(c.verified, i)
+		}
+		c.muTorrent.Unlock()
+		if torr != nil {
+			torr.Piece(i).UpdateCompletion()
+		}
+	}
+	if complete > 0 || bad > 0 {
+		log.TLogln("Load disk cache:", c.hash.HexString(), "pieces:", complete, "bad:", bad)
+	}
+}
+
+// SetPolicy sets torrent policy, nil uses global settings
+func (c *Cache) SetPolicy(policy *settings.TorrentPolicy) {
+	c.policy = policy
+	c.dlLimiter = nil
+	if policy != nil && policy.DownloadRateLimit > 0 {
+		c.dlLimiter = utils.Limit(policy.DownloadRateLimit * 1024)
+	}
+}
+
+// SetCapacity changes capacity of opened cache, 0 keeps current capacity
+func (c *Cache) SetCapacity(capacity int64) {
+	if capacity <= 0 || c.capacity == capacity {
+		return
+	}
+	c.capacity = capacity
+	go c.cleanPieces()
+}
+
+// SetKeep enables storing of all pieces to files with torrent layout, must be called before Init
+func (c *Cache) SetKeep(keep bool) {
+	c.isKeep = keep
+}
+
+// IsKeep reports whether cache stores all pieces to files
+func (c *Cache) IsKeep() bool {
+	return c != nil && c.keep != nil
+}
+
+// SetFilePriorities sets download priorities of files by path, files not in map have
+// normal priority. Keep torrent downloads all not skipped files, other torrents use
+// priorities for pieces in ranges of readers.
+func (c *Cache) SetFilePriorities(prio map[string]string) {
+	c.muFilePrio.Lock()
+	c.filePrio = prio
+	if c.getTorrent() != nil {
+		c.updatePiecePrio()
+	}
+	c.muFilePrio.Unlock()
+	if c.keep != nil && c.getTorrent() != nil {
+		c.DownloadAll()
+	}
+}
+
+// updatePiecePrio maps priorities of files to pieces, piece shared with not skipped file
+// isn't skipped, piece shared with high priority file is high, must be called under muFilePrio
+func (c *Cache) updatePiecePrio() {
+	prio := make(map[int]string)
+	if torr := c.getTorrent(); torr != nil && len(c.filePrio) > 0 {
+		files := torr.Files()
+		for _, f := range files {
+			if c.filePrio[f.Path()] != settings.FilePrioritySkip {
+				continue
+			}
+			begin, end := c.filePieces(f)
+			for i := begin; i < end; i++ {
+				prio[i] = settings.FilePrioritySkip
+			}
+		}
+		for _, f := range files {
+			fp := c.filePrio[f.Path()]
+			if fp == settings.FilePrioritySkip {
+				continue
+			}
+			begin, end := c.filePieces(f)
+			for i := begin; i < end; i++ {
+				if fp == settings.FilePriorityHigh {
+					prio[i] = fp
+				} else if prio[i] == settings.FilePrioritySkip {
+					delete(prio, i)
+				}
+			}
+		}
+	}
+	c.piecePrio = prio
+}
+
+// filePieces returns range of pieces of file [begin, end)
+func (c *Cache) filePieces(f *torrent.File) (int, int) {
+	if f.Length() == 0 {
+		return 0, 0
+	}
+	begin := int(f.Offset() / c.pieceLength)
+	end := int((f.Offset() + f.Length() + c.pieceLength - 1) / c.pieceLength)
+	return begin, end
+}
+
+// getPiecePrio returns download priorities of pieces by files priorities, map isn't changed
+func (c *Cache) getPiecePrio() map[int]string {
+	c.muFilePrio.Lock()
+	defer c.muFilePrio.Unlock()
+	return c.piecePrio
+}
+
+// DownloadAll downloads all files of keep torrent with their priorities,
+// pieces of skipped files are loaded only if they are shared with other files
+func (c *Cache) DownloadAll() {
+	torr := c.getTorrent()
+	if torr == nil {
+		return
+	}
+	prio := c.getPiecePrio()
+	for id := range c.pieces {
+		want := torrent.PiecePriorityNormal
+		switch prio[id] {
+		case settings.FilePrioritySkip:
+			want = torrent.PiecePriorityNone
+		case settings.FilePriorityHigh:
+			want = torrent.PiecePriorityHigh
+		}
+		if torr.PieceState(id).Priority != want {
+			torr.Piece(id).SetPriority(want)
+		}
+	}
+}
+
+// KeepCompletionPath returns path of piece completion file of keep torrent
+func KeepCompletionPath(hash metainfo.Hash) string {
+	return filepath.Join(settings.BTsets.TorrentsSavePath, ".keep", hash.HexString())
+}
+
+func (c *Cache) pieceSize(id int) int64 {
+	if rest := c.length - int64(id)*c.pieceLength; rest < c.pieceLength {
+		return rest
+	}
+	return c.pieceLength
+}
+
+func (c *Cache) readAhead() int {
+	if c.policy != nil && c.policy.ReaderReadAHead > 0 {
+		return c.policy.ReaderReadAHead
+	}
+	return settings.BTsets.ReaderReadAHead
+}
+
+func (c *Cache) connectionsLimit() int {
+	if c.policy != nil && c.policy.ConnectionsLimit > 0 {
+		return c.policy.ConnectionsLimit
+	}
+	return settings.BTsets.ConnectionsLimit
+}
+
+// waitDownload limits download rate of torrent by policy. Pieces are written by peer
+// connections in their read loop without lock of BT client, so the wait holds reading
+// from peers of torrent, like global limiter of client does for all connections.
+func (c *Cache) waitDownload(n int) {
+	l := c.dlLimiter
+	if l == nil {
+		return
+	}
+	for n > 0 {
+		k := min(n, l.Burst())
+		l.WaitN(context.Background(), k)
+		n -= k
+	}
 }
 
 func (c *Cache) SetTorrent(torr *torrent.Torrent) {
+	c.muTorrent.Lock()
 	c.torrent = torr
+	verified := c.verified
+	c.verified = nil
+	c.muTorrent.Unlock()
+	c.muFilePrio.Lock()
+	c.updatePiecePrio()
+	c.muFilePrio.Unlock()
+	// pieces checked before torrent was set, BT client got them as incomplete
+	for _, id := range verified {
+		torr.Piece(id).UpdateCompletion()
+	}
+}
+
+// getTorrent returns torrent of cache, nil until torrent is set
+func (c *Cache) getTorrent() *torrent.Torrent {
+	c.muTorrent.Lock()
+	defer c.muTorrent.Unlock()
+	return c.torrent
 }
 
 func (c *Cache) Piece(m metainfo.Piece) storage.PieceImpl {
@@ -89,6 +354,12 @@ func (c *Cache) Piece(m metainfo.Piece) storage.PieceImpl {
 func (c *Cache) Close() error {
 	log.TLogln("Close cache for:", c.hash)
 	c.isClosed = true
+	if c.verifyStop != nil {
+		// wait for check of piece in progress, pieces are released below
+		close(c.verifyStop)
+		<-c.verifyDone
+		c.verifyStop = nil
+	}
 
 	delete(c.storage.caches, c.hash)
 
@@ -98,8 +369,10 @@ func (c *Cache) Close() error {
 			for _, v := range c.pieces {
 				if v.dPiece != nil {
 					os.Remove(v.dPiece.name)
+					c.storage.addDiskUsed(-v.Size)
 				}
 			}
+			os.Remove(filepath.Join(name, completionName))
 			os.Remove(name)
 		}
 	}
@@ -138,7 +411,8 @@ func (c *Cache) GetState() *state.CacheState {
 	piecesState := make(map[int]state.ItemState, 0)
 	var fill int64 = 0
 
-	if len(c.pieces) > 0 {
+	torr := c.getTorrent()
+	if torr != nil && len(c.pieces) > 0 {
 		for _, p := range c.pieces {
 			if p.Size > 0 {
 				fill += p.Size
@@ -147,7 +421,7 @@ func (c *Cache) GetState() *state.CacheState {
 					Size:      p.Size,
 					Length:    c.pieceLength,
 					Completed: p.Complete,
-					Priority:  int(c.torrent.PieceState(p.Id).Priority),
+					Priority:  int(torr.PieceState(p.Id).Priority),
 				}
 			}
 		}
@@ -181,7 +455,7 @@ func (c *Cache) GetState() *state.CacheState {
 }
 
 func (c *Cache) cleanPieces() {
-	if c.isRemove || c.isClosed {
+	if c.isRemove || c.isClosed || c.keep != nil {
 		return
 	}
 	c.muRemove.Lock()
@@ -207,6 +481,33 @@ func (c *Cache) cleanPieces() {
 	}
 }
 
+// quotaPieces returns completed disk pieces allowed to remove by disk cache quota and used size
+func (c *Cache) quotaPieces() (pieces []*Piece, used int64) {
+	if c.isClosed || c.keep != nil {
+		return
+	}
+	ranges := make([]Range, 0)
+	c.muReaders.Lock()
+	for r := range c.readers {
+		if r.isUse {
+			ranges = append(ranges, r.getPiecesRange())
+		}
+	}
+	c.muReaders.Unlock()
+
+	for id, p := range c.pieces {
+		if p.dPiece == nil || p.Size == 0 {
+			continue
+		}
+		used += p.Size
+		if !p.Complete || inRanges(ranges, id) || c.isIdInFileBE(ranges, id) {
+			continue
+		}
+		pieces = append(pieces, p)
+	}
+	return
+}
+
 func (c *Cache) getRemPieces() []*Piece {
 	piecesRemove := make([]*Piece, 0)
 	fill := int64(0)
@@ -252,6 +553,11 @@ func (c *Cache) getRemPieces() []*Piece {
 }
 
 func (c *Cache) setLoadPriority(ranges []Range) {
+	torr := c.getTorrent()
+	if torr == nil {
+		return
+	}
+	prio := c.getPiecePrio()
 	c.muReaders.Lock()
 	for r := range c.readers {
 		if !r.isUse {
@@ -263,20 +569,25 @@ func (c *Cache) setLoadPriority(ranges []Range) {
 		readerPos := r.getReaderPiece()
 		readerRAHPos := r.getReaderRAHPiece()
 		end := r.getPiecesRange().End
-		count := settings.BTsets.ConnectionsLimit / len(c.readers) // max concurrent loading blocks
+		count := c.connectionsLimit() / len(c.readers) // max concurrent loading blocks
 		limit := 0
 		for i := readerPos; i < end && limit < count; i++ {
+			if prio[i] == settings.FilePrioritySkip {
+				continue
+			}
 			if !c.pieces[i].Complete {
 				if i == readerPos {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityNow)
+					torr.Piece(i).SetPriority(torrent.PiecePriorityNow)
 				} else if i == readerPos+1 {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityNext)
+					torr.Piece(i).SetPriority(torrent.PiecePriorityNext)
 				} else if i > readerPos && i <= readerRAHPos {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityReadahead)
-				} else if i > readerRAHPos && i <= readerRAHPos+5 && c.torrent.PieceState(i).Priority != torrent.PiecePriorityHigh {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityHigh)
-				} else if i > readerRAHPos+5 && c.torrent.PieceState(i).Priority != torrent.PiecePriorityNormal {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityNormal)
+					torr.Piece(i).SetPriority(torrent.PiecePriorityReadahead)
+				} else if i > readerRAHPos && (i <= readerRAHPos+5 || prio[i] == settings.FilePriorityHigh) {
+					if torr.PieceState(i).Priority != torrent.PiecePriorityHigh {
+						torr.Piece(i).SetPriority(torrent.PiecePriorityHigh)
+					}
+				} else if i > readerRAHPos+5 && torr.PieceState(i).Priority != torrent.PiecePriorityNormal {
+					torr.Piece(i).SetPriority(torrent.PiecePriorityNormal)
 				}
 				limit++
 			}
@@ -351,6 +662,11 @@ func (c *Cache) CloseReader(r *Reader) {
 
 func (c *Cache) clearPriority() {
 	time.Sleep(time.Second)
+	if c.keep != nil {
+		// keep torrent downloads all files
+		c.DownloadAll()
+		return
+	}
 	ranges := make([]Range, 0)
 	c.muReaders.Lock()
 	for r := range c.readers {
@@ -362,17 +678,18 @@ func (c *Cache) clearPriority() {
 	c.muReaders.Unlock()
 	ranges = mergeRange(ranges)
 
+	torr := c.getTorrent()
+	if torr == nil {
+		return
+	}
+	prio := c.getPiecePrio()
 	for id := range c.pieces {
-		if len(ranges) > 0 {
-			if !inRanges(ranges, id) {
-				if c.torrent.PieceState(id).Priority != torrent.PiecePriorityNone {
-					c.torrent.Piece(id).SetPriority(torrent.PiecePriorityNone)
-				}
-			}
-		} else {
-			if c.torrent.PieceState(id).Priority != torrent.PiecePriorityNone {
-				c.torrent.Piece(id).SetPriority(torrent.PiecePriorityNone)
-			}
+		// pieces of skipped files aren't loaded even in ranges of readers
+		if len(ranges) > 0 && inRanges(ranges, id) && prio[id] != settings.FilePrioritySkip {
+			continue
+		}
+		if torr.PieceState(id).Priority != torrent.PiecePriorityNone {
+			torr.Piece(id).SetPriority(torrent.PiecePriorityNone)
 		}
 	}
 }
@@ -0,0 +1,81 @@
+package torrstor
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"server/log"
+)
+
+// completionName is file name of piece completion in disk cache dir of torrent
+const completionName = ".completion"
+
+// pieceCompletion keeps completed pieces of torrent in bitfield file
+type pieceCompletion struct {
+	name string
+	bits []byte
+	mu   sync.Mutex
+}
+
+func newPieceCompletion(name string, count int) *pieceCompletion {
+	pc := &pieceCompletion{
+		name: name,
+		bits: make([]byte, (count+7)/8),
+	}
+	if buf, err := os.ReadFile(name); err == nil && len(buf) == len(pc.bits) {
+		copy(pc.bits, buf)
+	}
+	return pc
+}
+
+// openPieceCompletion opens existing completion file with unknown pieces count
+func openPieceCompletion(name string) *pieceCompletion {
+	count := 0
+	if fi, err := os.Stat(name); err == nil {
+		count = int(fi.Size()) * 8
+	}
+	return newPieceCompletion(name, count)
+}
+
+func (pc *pieceCompletion) Get(id int) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if id < 0 || id/8 >= len(pc.bits) {
+		return false
+	}
+	return pc.bits[id/8]&(1<<(id%8)) != 0
+}
+
+func (pc *pieceCompletion) Set(id int, complete bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if id < 0 || id/8 >= len(pc.bits) {
+		return
+	}
+	old := pc.bits[id/8]
+	if complete {
+		pc.bits[id/8] |= 1 << (id % 8)
+	} else {
+		pc.bits[id/8] &^= 1 << (id % 8)
+	}
+	if old == pc.bits[id/8] {
+		return
+	}
+	if err := pc.save(); err != nil {
+		log.TLogln("Error save piece completion:", err)
+	}
+}
+
+// save writes bitfield to temp file and renames it, so crash while writing doesn't break completion
+func (pc *pieceCompletion) save() error {
+	if err := os.MkdirAll(filepath.Dir(pc.name), 0o777); err != nil {
+		return err
+	}
+	tmp := pc.name + ".tmp"
+	if err := os.WriteFile(tmp, pc.bits, 0o666); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, pc.name)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package torrstor
+
+import (
+	"syscall"
+)
+
+// diskFree returns free space available for user on disk of path
+func diskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package torrstor
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// diskFree returns free space available for user on disk of path
+func diskFree(path string) (int64, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err = windows.GetDiskFreeSpaceEx(name, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(free), nil
+}
@@ -1,6 +1,8 @@
 package torrstor
 
 import (
+	"bytes"
+	"crypto/sha1"
 	"io"
 	"os"
 	"path/filepath"
@@ -8,6 +10,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/anacrolix/torrent/metainfo"
+
 	"server/log"
 	"server/settings"
 )
@@ -25,7 +29,7 @@ func NewDiskPiece(p *Piece) *DiskPiece {
 	ff, err := os.Stat(name)
 	if err == nil {
 		p.Size = ff.Size()
-		p.Complete = ff.Size() == p.cache.pieceLength
+		p.Complete = p.cache.completion != nil && p.cache.completion.Get(p.Id) && ff.Size() == p.cache.pieceSize(p.Id)
 		p.Accessed = ff.ModTime().Unix()
 	}
 	return &DiskPiece{piece: p, name: name}
@@ -41,12 +45,17 @@ func (p *DiskPiece) WriteAt(b []byte, off int64) (n int, err error) {
 		return 0, err
 	}
 	defer ff.Close()
+	if p.piece.Size == 0 {
+		go p.piece.cache.storage.checkQuota()
+	}
 	n, err = ff.WriteAt(b, off)
 
+	size := p.piece.Size
 	p.piece.Size += int64(n)
 	if p.piece.Size > p.piece.cache.pieceLength {
 		p.piece.Size = p.piece.cache.pieceLength
 	}
+	p.piece.cache.storage.addDiskUsed(p.piece.Size - size)
 	p.piece.Accessed = time.Now().Unix()
 	return
 }
@@ -78,8 +87,30 @@ func (p *DiskPiece) Release() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	p.piece.cache.storage.addDiskUsed(-p.piece.Size)
 	p.piece.Size = 0
 	p.piece.Complete = false
+	if p.piece.cache.completion != nil {
+		p.piece.cache.completion.Set(p.piece.Id, false)
+	}
 
 	os.Remove(p.name)
 }
+
+// Verify checks sha1 of piece file
+func (p *DiskPiece) Verify(hash metainfo.Hash) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	ff, err := os.Open(p.name)
+	if err != nil {
+		return false
+	}
+	defer ff.Close()
+
+	h := sha1.New()
+	if _, err = io.Copy(h, ff); err != nil {
+		return false
+	}
+	return bytes.Equal(h.Sum(nil), hash[:])
+}
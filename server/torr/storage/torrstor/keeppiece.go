@@ -0,0 +1,185 @@
+package torrstor
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"server/log"
+)
+
+// keepFiles stores pieces of torrent in files with torrent layout
+type keepFiles struct {
+	files []keepFile
+	mu    sync.Mutex
+}
+
+type keepFile struct {
+	name   string
+	offset int64
+	length int64
+}
+
+func newKeepFiles(dir string, hash metainfo.Hash, info *metainfo.Info) *keepFiles {
+	kf := new(keepFiles)
+	var offset int64
+	root := keepDirName(info, hash)
+	for _, fi := range info.UpvertedFiles() {
+		parts := []string{dir, root}
+		for _, p := range fi.BestPath() {
+			parts = append(parts, safePathPart(p))
+		}
+		f := keepFile{name: filepath.Join(parts...), offset: offset, length: fi.Length}
+		if f.length == 0 {
+			if err := os.MkdirAll(filepath.Dir(f.name), 0o777); err == nil {
+				if ff, err := os.OpenFile(f.name, os.O_RDWR|os.O_CREATE, 0o666); err == nil {
+					ff.Close()
+				}
+			}
+		}
+		kf.files = append(kf.files, f)
+		offset += fi.Length
+	}
+	return kf
+}
+
+// keepDirName returns name of torrent directory in save path, short hash
+// separates torrents with the same name
+func keepDirName(info *metainfo.Info, hash metainfo.Hash) string {
+	return safePathPart(info.BestName()) + " [" + hash.HexString()[:8] + "]"
+}
+
+// safePathPart protects from path traversal by torrent file names
+func safePathPart(p string) string {
+	if p == "" || p == "." || p == ".." {
+		return "_"
+	}
+	return filepath.Base(filepath.FromSlash(p))
+}
+
+// rw calls fn for every part of files in range [off, off+len(b))
+func (kf *keepFiles) rw(b []byte, off int64, fn func(f keepFile, b []byte, off int64) (int, error)) (n int, err error) {
+	for _, f := range kf.files {
+		if len(b) == 0 {
+			break
+		}
+		if off >= f.offset+f.length || f.length == 0 {
+			continue
+		}
+		if off < f.offset {
+			break
+		}
+		part := b
+		if rest := f.offset + f.length - off; int64(len(part)) > rest {
+			part = part[:rest]
+		}
+		k, e := fn(f, part, off-f.offset)
+		n += k
+		if e != nil {
+			return n, e
+		}
+		b = b[k:]
+		off += int64(k)
+	}
+	return n, nil
+}
+
+func (kf *keepFiles) WriteAt(b []byte, off int64) (int, error) {
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+	return kf.rw(b, off, func(f keepFile, b []byte, off int64) (int, error) {
+		if err := os.MkdirAll(filepath.Dir(f.name), 0o777); err != nil {
+			return 0, err
+		}
+		ff, err := os.OpenFile(f.name, os.O_RDWR|os.O_CREATE, 0o666)
+		if err != nil {
+			return 0, err
+		}
+		defer ff.Close()
+		return ff.WriteAt(b, off)
+	})
+}
+
+func (kf *keepFiles) ReadAt(b []byte, off int64) (int, error) {
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+	return kf.rw(b, off, func(f keepFile, b []byte, off int64) (int, error) {
+		ff, err := os.Open(f.name)
+		if os.IsNotExist(err) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer ff.Close()
+		n, err := ff.ReadAt(b, off)
+		if err == io.EOF && n == len(b) {
+			err = nil
+		}
+		return n, err
+	})
+}
+
+type KeepPiece struct {
+	piece *Piece
+}
+
+func NewKeepPiece(p *Piece) *KeepPiece {
+	if p.cache.completion.Get(p.Id) {
+		p.Size = p.cache.pieceSize(p.Id)
+		p.Complete = true
+		p.Accessed = time.Now().Unix()
+	}
+	return &KeepPiece{piece: p}
+}
+
+func (p *KeepPiece) WriteAt(b []byte, off int64) (n int, err error) {
+	n, err = p.piece.cache.keep.WriteAt(b, int64(p.piece.Id)*p.piece.cache.pieceLength+off)
+	if err != nil {
+		log.TLogln("Error write file:", err)
+	}
+	p.piece.Size += int64(n)
+	if p.piece.Size > p.piece.cache.pieceLength {
+		p.piece.Size = p.piece.cache.pieceLength
+	}
+	p.piece.Accessed = time.Now().Unix()
+	return
+}
+
+func (p *KeepPiece) ReadAt(b []byte, off int64) (n int, err error) {
+	n, err = p.piece.cache.keep.ReadAt(b, int64(p.piece.Id)*p.piece.cache.pieceLength+off)
+	p.piece.Accessed = time.Now().Unix()
+	if n < len(b) && p.piece.Complete {
+		// file was truncated or removed, piece must be downloaded again
+		log.TLogln("Short read of keep piece:", p.piece.Id, n, "/", len(b))
+		p.piece.Complete = false
+		p.piece.cache.completion.Set(p.piece.Id, false)
+		if err == nil {
+			err = io.EOF
+		}
+	}
+	return
+}
+
+// Verify checks sha1 of piece data in files
+func (p *KeepPiece) Verify(hash metainfo.Hash) bool {
+	buf := make([]byte, p.piece.cache.pieceSize(p.piece.Id))
+	n, err := p.piece.cache.keep.ReadAt(buf, int64(p.piece.Id)*p.piece.cache.pieceLength)
+	if err != nil || n < len(buf) {
+		return false
+	}
+	sum := sha1.Sum(buf)
+	return bytes.Equal(sum[:], hash[:])
+}
+
+func (p *KeepPiece) Release() {
+	p.piece.Size = 0
+	p.piece.Complete = false
+	p.piece.cache.completion.Set(p.piece.Id, false)
+}
@@ -17,6 +17,7 @@ type Piece struct {
 
 	mPiece *MemPiece  `json:"-"`
 	dPiece *DiskPiece `json:"-"`
+	kPiece *KeepPiece `json:"-"`
 
 	cache *Cache `json:"-"`
 }
@@ -27,7 +28,9 @@ func NewPiece(id int, cache *Cache) *Piece {
 		cache: cache,
 	}
 
-	if !settings.BTsets.UseDisk {
+	if cache.keep != nil {
+		p.kPiece = NewKeepPiece(p)
+	} else if !settings.BTsets.UseDisk {
 		p.mPiece = NewMemPiece(p)
 	} else {
 		p.dPiece = NewDiskPiece(p)
@@ -36,6 +39,10 @@ func NewPiece(id int, cache *Cache) *Piece {
 }
 
 func (p *Piece) WriteAt(b []byte, off int64) (n int, err error) {
+	p.cache.waitDownload(len(b))
+	if p.kPiece != nil {
+		return p.kPiece.WriteAt(b, off)
+	}
 	if !settings.BTsets.UseDisk {
 		return p.mPiece.WriteAt(b, off)
 	} else {
@@ -44,6 +51,9 @@ func (p *Piece) WriteAt(b []byte, off int64) (n int, err error) {
 }
 
 func (p *Piece) ReadAt(b []byte, off int64) (n int, err error) {
+	if p.kPiece != nil {
+		return p.kPiece.ReadAt(b, off)
+	}
 	if !settings.BTsets.UseDisk {
 		return p.mPiece.ReadAt(b, off)
 	} else {
@@ -53,11 +63,17 @@ func (p *Piece) ReadAt(b []byte, off int64) (n int, err error) {
 
 func (p *Piece) MarkComplete() error {
 	p.Complete = true
+	if p.cache.completion != nil {
+		p.cache.completion.Set(p.Id, true)
+	}
 	return nil
 }
 
 func (p *Piece) MarkNotComplete() error {
 	p.Complete = false
+	if p.cache.completion != nil {
+		p.cache.completion.Set(p.Id, false)
+	}
 	return nil
 }
 
@@ -69,13 +85,15 @@ func (p *Piece) Completion() storage.Completion {
 }
 
 func (p *Piece) Release() {
-	if !settings.BTsets.UseDisk {
+	if p.kPiece != nil {
+		p.kPiece.Release()
+	} else if !settings.BTsets.UseDisk {
 		p.mPiece.Release()
 	} else {
 		p.dPiece.Release()
 	}
-	if !p.cache.isClosed {
-		p.cache.torrent.Piece(p.Id).SetPriority(torrent.PiecePriorityNone)
-		p.cache.torrent.Piece(p.Id).UpdateCompletion()
+	if torr := p.cache.getTorrent(); torr != nil && !p.cache.isClosed {
+		torr.Piece(p.Id).SetPriority(torrent.PiecePriorityNone)
+		torr.Piece(p.Id).UpdateCompletion()
 	}
 }
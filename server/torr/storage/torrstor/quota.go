@@ -0,0 +1,217 @@
+package torrstor
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"server/log"
+	"server/settings"
+	"server/torr/storage/state"
+)
+
+// quotaPiece is piece of disk cache, piece of active cache or piece file of closed torrent
+type quotaPiece struct {
+	accessed int64
+	size     int64
+
+	piece *Piece
+
+	name       string
+	completion string
+	id         int
+}
+
+// quotaInterval is min interval between scans of disk cache
+const quotaInterval = 5 * time.Second
+
+func quotaEnabled() bool {
+	return settings.BTsets.UseDisk && settings.BTsets.TorrentsSavePath != "" &&
+		(settings.BTsets.DiskCacheQuota > 0 || settings.BTsets.DiskCacheQuotaPercent > 0)
+}
+
+func isHashName(name string) bool {
+	buf, err := hex.DecodeString(name)
+	return err == nil && len(buf) == 20
+}
+
+// scanDiskCache returns pieces allowed to remove and used size of disk cache of all torrents
+func (s *Storage) scanDiskCache() (pieces []*quotaPiece, used int64, caches int) {
+	root := settings.BTsets.TorrentsSavePath
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+
+	active := make(map[string]*Cache)
+	s.mu.Lock()
+	for hash, c := range s.caches {
+		active[hash.HexString()] = c
+	}
+	s.mu.Unlock()
+
+	for _, d := range dirs {
+		if !d.IsDir() || !isHashName(d.Name()) {
+			continue
+		}
+		if c, ok := active[d.Name()]; ok {
+			list, size := c.quotaPieces()
+			for _, p := range list {
+				pieces = append(pieces, &quotaPiece{accessed: p.Accessed, size: p.Size, piece: p})
+			}
+			if size > 0 {
+				used += size
+				caches++
+			}
+			continue
+		}
+		dir := filepath.Join(root, d.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		size := int64(0)
+		for _, f := range files {
+			id, err := strconv.Atoi(f.Name())
+			if err != nil || f.IsDir() {
+				continue
+			}
+			fi, err := f.Info()
+			if err != nil {
+				continue
+			}
+			size += fi.Size()
+			pieces = append(pieces, &quotaPiece{
+				accessed:   fi.ModTime().Unix(),
+				size:       fi.Size(),
+				name:       filepath.Join(dir, f.Name()),
+				completion: filepath.Join(dir, completionName),
+				id:         id,
+			})
+		}
+		if size > 0 {
+			used += size
+			caches++
+		}
+	}
+	return
+}
+
+func quotaLimit(used int64) int64 {
+	limit := settings.BTsets.DiskCacheQuota
+	if prc := settings.BTsets.DiskCacheQuotaPercent; prc > 0 {
+		free, err := diskFree(settings.BTsets.TorrentsSavePath)
+		if err != nil {
+			log.TLogln("Error get free disk space:", err)
+			return limit
+		}
+		// cache may use percent of free space including space used by cache
+		if l := (free + used) * int64(prc) / 100; limit == 0 || l < limit {
+			limit = l
+		}
+	}
+	return limit
+}
+
+// addDiskUsed changes size of disk cache on write and remove of pieces
+func (s *Storage) addDiskUsed(n int64) {
+	if n != 0 {
+		s.diskUsed.Add(n)
+	}
+}
+
+// deferQuota runs check of quota after delay, only one check is waiting
+func (s *Storage) deferQuota(delay time.Duration) {
+	if !s.quotaDeferred.CompareAndSwap(false, true) {
+		return
+	}
+	time.AfterFunc(delay, func() {
+		s.quotaDeferred.Store(false)
+		s.checkQuota()
+	})
+}
+
+// checkQuota removes least recently accessed pieces of all torrents if disk cache exceeds quota.
+// Size of disk cache is counted on writes and removes of pieces, cache dirs are scanned only
+// to find pieces to remove, that also corrects the counter by files removed outside of storage.
+func (s *Storage) checkQuota() {
+	if !quotaEnabled() {
+		return
+	}
+	if s.diskScanned.Load() {
+		used := s.diskUsed.Load()
+		if limit := quotaLimit(used); limit <= 0 || used <= limit {
+			return
+		}
+	}
+	if !s.quotaRun.CompareAndSwap(false, true) {
+		// running check may miss pieces written after its scan
+		s.deferQuota(quotaInterval)
+		return
+	}
+	defer s.quotaRun.Store(false)
+	if wait := time.Until(time.Unix(s.quotaTime.Load(), 0).Add(quotaInterval)); wait > 0 {
+		s.deferQuota(wait)
+		return
+	}
+	defer func() { s.quotaTime.Store(time.Now().Unix()) }()
+
+	pieces, used, _ := s.scanDiskCache()
+	s.diskUsed.Store(used)
+	s.diskScanned.Store(true)
+	limit := quotaLimit(used)
+	if limit <= 0 || used <= limit {
+		return
+	}
+
+	sort.Slice(pieces, func(i, j int) bool {
+		return pieces[i].accessed < pieces[j].accessed
+	})
+
+	completions := make(map[string]*pieceCompletion)
+	removed := int64(0)
+	for _, p := range pieces {
+		if used <= limit {
+			break
+		}
+		if p.piece != nil {
+			// release of piece changes counter of disk cache
+			p.piece.cache.removePiece(p.piece)
+		} else {
+			if err := os.Remove(p.name); err != nil {
+				continue
+			}
+			s.addDiskUsed(-p.size)
+			pc, ok := completions[p.completion]
+			if !ok {
+				pc = openPieceCompletion(p.completion)
+				completions[p.completion] = pc
+			}
+			pc.Set(p.id, false)
+		}
+		used -= p.size
+		removed += p.size
+	}
+	log.TLogln("Disk cache quota, removed:", removed, "used:", used, "quota:", limit)
+}
+
+// DiskUsage returns usage of disk cache of all torrents
+func (s *Storage) DiskUsage() *state.DiskCacheState {
+	st := new(state.DiskCacheState)
+	if !settings.BTsets.UseDisk || settings.BTsets.TorrentsSavePath == "" {
+		return st
+	}
+	_, st.Used, st.Caches = s.scanDiskCache()
+	s.diskUsed.Store(st.Used)
+	s.diskScanned.Store(true)
+	if free, err := diskFree(settings.BTsets.TorrentsSavePath); err == nil {
+		st.Free = free
+	}
+	if quotaEnabled() {
+		st.Quota = quotaLimit(st.Used)
+	}
+	return st
+}
@@ -8,13 +8,13 @@ import (
 	"github.com/anacrolix/torrent"
 
 	"server/log"
-	"server/settings"
 )
 
 type Reader struct {
 	torrent.Reader
 	offset    int64
 	readahead int64
+	readBytes int64
 	file      *torrent.File
 
 	cache    *Cache
@@ -88,6 +88,7 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 		//}
 
 		r.offset += int64(n)
+		r.readBytes += int64(n)
 		r.lastAccess = time.Now().Unix()
 	} else {
 		log.TLogln("Torrent closed and readed")
@@ -109,6 +110,11 @@ func (r *Reader) Offset() int64 {
 	return r.offset
 }
 
+// ReadBytes returns count of bytes read by reader
+func (r *Reader) ReadBytes() int64 {
+	return r.readBytes
+}
+
 func (r *Reader) Readahead() int64 {
 	return r.readahead
 }
@@ -141,7 +147,7 @@ func (r *Reader) getPieceNum(offset int64) int {
 }
 
 func (r *Reader) getOffsetRange() (int64, int64) {
-	prc := int64(settings.BTsets.ReaderReadAHead)
+	prc := int64(r.cache.readAhead())
 	readers := int64(r.getUseReaders())
 	if readers == 0 {
 		readers = 1
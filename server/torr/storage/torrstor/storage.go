@@ -2,7 +2,9 @@ package torrstor
 
 import (
 	"sync"
+	"sync/atomic"
 
+	"server/settings"
 	"server/torr/storage"
 
 	"github.com/anacrolix/torrent/metainfo"
@@ -13,14 +15,24 @@ type Storage struct {
 	storage.Storage
 
 	caches   map[metainfo.Hash]*Cache
+	policies map[metainfo.Hash]*settings.TorrentPolicy
+	keeps    map[metainfo.Hash]bool
 	capacity int64
 	mu       sync.Mutex
+
+	quotaRun      atomic.Bool
+	quotaTime     atomic.Int64
+	quotaDeferred atomic.Bool
+	diskUsed      atomic.Int64 // size of disk cache, counted by writes and removes of pieces
+	diskScanned   atomic.Bool  // diskUsed is set by scan of disk cache
 }
 
 func NewStorage(capacity int64) *Storage {
 	stor := new(Storage)
 	stor.capacity = capacity
 	stor.caches = make(map[metainfo.Hash]*Cache)
+	stor.policies = make(map[metainfo.Hash]*settings.TorrentPolicy)
+	stor.keeps = make(map[metainfo.Hash]bool)
 	return stor
 }
 
@@ -30,9 +42,19 @@ func (s *Storage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (ts.T
 	// } //	NE
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	ch := NewCache(s.capacity, s)
+	capacity := s.capacity
+	policy := s.policies[infoHash]
+	delete(s.policies, infoHash)
+	if policy != nil && policy.CacheSize > 0 {
+		capacity = policy.CacheSize
+	}
+	ch := NewCache(capacity, s)
+	ch.SetPolicy(policy)
+	ch.SetKeep(s.keeps[infoHash])
+	delete(s.keeps, infoHash)
 	ch.Init(info, infoHash)
 	s.caches[infoHash] = ch
+	go s.checkQuota()
 	return ch, nil //	OE
 	// return ts.TorrentImpl{ //	NE
 	// 	Piece:    ch.Piece, //	NE
@@ -41,6 +63,36 @@ func (s *Storage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (ts.T
 	// }, nil //	NE
 }
 
+// SetPolicy sets torrent policy used on open cache of torrent
+func (s *Storage) SetPolicy(hash metainfo.Hash, policy *settings.TorrentPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies[hash] = policy
+}
+
+// SetCapacity sets cache capacity for torrents opened later
+func (s *Storage) SetCapacity(capacity int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capacity = capacity
+}
+
+// SetKeep sets torrent to store all pieces to files on open cache of torrent
+func (s *Storage) SetKeep(hash metainfo.Hash, keep bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keeps[hash] = keep
+}
+
+// ClearHash removes policy and keep mode set for torrent not opened yet,
+// torrent can be dropped before it gets info and cache is opened
+func (s *Storage) ClearHash(hash metainfo.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.policies, hash)
+	delete(s.keeps, hash)
+}
+
 func (s *Storage) CloseHash(hash metainfo.Hash) {
 	if s.caches == nil {
 		return
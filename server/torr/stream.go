@@ -1,12 +1,15 @@
 package torr
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/anacrolix/dms/dlna"
@@ -16,14 +19,28 @@ import (
 	mt "server/mimetype"
 	sets "server/settings"
 	"server/torr/state"
+	"server/torr/storage/torrstor"
 )
 
-func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter) error {
-	if !t.GotInfo() {
-		http.NotFound(resp, req)
-		return errors.New("torrent don't get info")
-	}
+// internalKey marks /play links of ffprobe and ffmpeg run by server, their reads
+// aren't playback of user and don't change viewed files and playback positions
+var internalKey = func() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}()
 
+// isInternalRead reports if request is read of file by ffprobe or ffmpeg run by server
+func isInternalRead(req *http.Request) bool {
+	return req.URL.Query().Get("internal") == internalKey
+}
+
+// minimal bytes read by request to save playback position,
+// smaller reads are usually players probing headers or index
+const minPositionRead = 4 << 20
+
+// streamFile returns file of torrent by file id of status
+func (t *Torrent) streamFile(fileID int) (*torrent.File, error) {
 	st := t.Status()
 	var stFile *state.TorrentFileStat
 	for _, fileStat := range st.FileStats {
@@ -33,19 +50,27 @@ func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter
 		}
 	}
 	if stFile == nil {
-		return fmt.Errorf("file with id %v not found", fileID)
+		return nil, fmt.Errorf("file with id %v not found", fileID)
 	}
 
 	files := t.Files()
-	var file *torrent.File
 	for _, tfile := range files {
 		if tfile.Path() == stFile.Path {
-			file = tfile
-			break
+			return tfile, nil
 		}
 	}
-	if file == nil {
-		return fmt.Errorf("file with id %v not found", fileID)
+	return nil, fmt.Errorf("file with id %v not found", fileID)
+}
+
+func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter) error {
+	if !t.GotInfo() {
+		http.NotFound(resp, req)
+		return errors.New("torrent don't get info")
+	}
+
+	file, err := t.streamFile(fileID)
+	if err != nil {
+		return err
 	}
 
 	if int64(sets.MaxSize) > 0 && file.Length() > int64(sets.MaxSize) {
@@ -56,6 +81,8 @@ func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter
 	}
 
 	reader := t.NewReader(file)
+	t.streamRequests.Add(1)
+	streamRequestsTotal.Add(1)
 	if sets.BTsets.ResponsiveMode {
 		reader.SetResponsive()
 	}
@@ -69,7 +96,10 @@ func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter
 		}
 	}
 
-	sets.SetViewed(&sets.Viewed{Hash: t.Hash().HexString(), FileIndex: fileID})
+	internal := isInternalRead(req)
+	if !internal {
+		sets.SetViewed(&sets.Viewed{Hash: t.Hash().HexString(), FileIndex: fileID})
+	}
 
 	resp.Header().Set("Connection", "close")
 	etag := hex.EncodeToString([]byte(fmt.Sprintf("%s/%s", t.Hash().HexString(), file.Path())))
@@ -87,8 +117,11 @@ func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter
 		}.String())
 	}
 
-	http.ServeContent(resp, req, file.Path(), time.Unix(t.Timestamp, 0), reader)
+	http.ServeContent(resp, req, file.Path(), time.Unix(t.Timestamp, 0), &streamReader{reader, t})
 
+	if !internal {
+		t.savePosition(fileID, file.Length(), reader)
+	}
 	t.CloseReader(reader)
 	if sets.BTsets.EnableDebug {
 		if err != nil {
@@ -99,3 +132,54 @@ func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter
 	}
 	return nil
 }
+
+// ReadFile reads small file of torrent fully, like subtitles
+func (t *Torrent) ReadFile(fileID int, max int64) ([]byte, error) {
+	if !t.GotInfo() {
+		return nil, errors.New("torrent don't get info")
+	}
+	file, err := t.streamFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.Length() > max {
+		return nil, fmt.Errorf("file size exceeded max allowed %d bytes", max)
+	}
+	reader := t.NewReader(file)
+	if reader == nil {
+		return nil, errors.New("torrent closed")
+	}
+	defer t.CloseReader(reader)
+	return io.ReadAll(io.LimitReader(reader, file.Length()))
+}
+
+// LocalPlayLink returns /play link of torrent file on this server for ffprobe and ffmpeg
+func LocalPlayLink(hash string, index int) string {
+	link := "http://127.0.0.1:" + sets.Port + "/play/" + hash + "/" + strconv.Itoa(index)
+	if sets.Ssl {
+		link = "https://127.0.0.1:" + sets.SslPort + "/play/" + hash + "/" + strconv.Itoa(index)
+	}
+	// ffmpeg reads original file, not transcoded by profile selected for its User-Agent
+	link += "?profile=none&internal=" + internalKey
+	if sets.HttpAuth {
+		link += "&" + sets.StreamToken(hash, index)
+	}
+	return link
+}
+
+func (t *Torrent) savePosition(fileID int, length int64, reader *torrstor.Reader) {
+	if reader.ReadBytes() < minPositionRead {
+		return
+	}
+	vv := &sets.Viewed{
+		Hash:      t.Hash().HexString(),
+		FileIndex: fileID,
+		Offset:    reader.Offset(),
+		Length:    length,
+	}
+	// duration of this file, torrent duration is of preloaded file only
+	if info := cachedMediaInfo(vv.Hash, fileID); info != nil {
+		vv.Duration = info.Duration
+	}
+	sets.SetPosition(vv)
+}
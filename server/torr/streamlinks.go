@@ -8,6 +8,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+
 	"server/log"
 	mt "server/mimetype"
 	"server/settings"
@@ -228,7 +229,7 @@ func buildStreamLink(baseURL, hashHex, path string, id int) string {
 	}
 	name := filepath.Base(path)
 	escaped := url.PathEscape(name)
-	return fmt.Sprintf("%s/stream/%s?link=%s&index=%d&play", baseURL, escaped, hashHex, id)
+	return fmt.Sprintf("%s/stream/%s?link=%s&index=%d&play%s", baseURL, escaped, hashHex, id, settings.StreamLinkToken(hashHex, id))
 }
 
 func defaultStreamHost() string {
@@ -2,8 +2,8 @@ package torr
 
 import (
 	"errors"
-	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	utils2 "server/utils"
@@ -24,6 +24,12 @@ type Torrent struct {
 	Category string
 	Poster   string
 	Data     string
+	Keep     bool // download fully to TorrentsSavePath
+	Tags     []string
+	// download priorities of files by file id, normal priority is not stored,
+	// map of loaded torrent is replaced under muPrio, not changed
+	FilePriorities map[int]string
+	muPrio         sync.Mutex
 	*torrent.TorrentSpec
 
 	Stat      state.TorrentStat
@@ -53,29 +59,53 @@ type Torrent struct {
 	closed <-chan struct{}
 
 	progressTicker *time.Ticker
+
+	policy *settings.TorrentPolicy
+
+	streamRequests atomic.Int64
+	streamBytes    atomic.Int64
 }
 
-func NewTorrent(spec *torrent.TorrentSpec, bt *BTServer) (*Torrent, error) {
-	// https://github.com/anacrolix/torrent/issues/747
-	if bt == nil || bt.client == nil {
-		return nil, errors.New("BT client not connected")
-	}
+// retrackers changes trackers of torrent by retrackers mode and adds trackers from file
+func retrackers(trackers [][]string) [][]string {
 	switch settings.BTsets.RetrackersMode {
 	case 1:
-		spec.Trackers = append(spec.Trackers, [][]string{utils.GetDefTrackers()}...)
+		trackers = append(trackers, [][]string{utils.GetDefTrackers()}...)
 	case 2:
-		spec.Trackers = nil
+		trackers = nil
 	case 3:
-		spec.Trackers = [][]string{utils.GetDefTrackers()}
+		trackers = [][]string{utils.GetDefTrackers()}
 	}
 
-	trackers := utils.GetTrackerFromFile()
-	if len(trackers) > 0 {
-		spec.Trackers = append(spec.Trackers, [][]string{trackers}...)
+	if list := utils.GetTrackerFromFile(); len(list) > 0 {
+		trackers = append(trackers, [][]string{list}...)
 	}
+	return trackers
+}
+
+func NewTorrent(spec *torrent.TorrentSpec, category string, bt *BTServer) (*Torrent, error) {
+	// https://github.com/anacrolix/torrent/issues/747
+	if bt == nil || bt.client == nil {
+		return nil, errors.New("BT client not connected")
+	}
+	spec.Trackers = retrackers(spec.Trackers)
+
+	// policy must be set before add, storage opens cache on add if spec has info
+	policy := settings.GetPolicy(spec.InfoHash.HexString(), category)
+	bt.storage.SetPolicy(spec.InfoHash, policy)
+	keep := false
+	var tags []string
+	var prio map[int]string
+	if db := settings.GetTorrent(spec.InfoHash); db != nil {
+		keep = db.Keep && settings.BTsets.TorrentsSavePath != ""
+		tags = db.Tags
+		prio = db.FilePriorities
+	}
+	bt.storage.SetKeep(spec.InfoHash, keep)
 
 	goTorrent, _, err := bt.client.AddTorrentSpec(spec)
 	if err != nil {
+		bt.storage.ClearHash(spec.InfoHash)
 		return nil, err
 	}
 
@@ -97,9 +127,18 @@ func NewTorrent(spec *torrent.TorrentSpec, bt *BTServer) (*Torrent, error) {
 	torr.bt = bt
 	torr.closed = goTorrent.Closed()
 	torr.TorrentSpec = spec
+	torr.Category = category
+	torr.Keep = keep
+	torr.Tags = tags
+	torr.FilePriorities = prio
+	torr.policy = policy
 	torr.AddExpiredTime(timeout)
 	torr.Timestamp = time.Now().Unix()
 
+	if policy.ConnectionsLimit > 0 {
+		goTorrent.SetMaxEstablishedConns(policy.ConnectionsLimit)
+	}
+
 	go torr.watch()
 
 	bt.torrents[spec.InfoHash] = torr
@@ -118,6 +157,7 @@ func (t *Torrent) WaitInfo() bool {
 	case <-t.Torrent.GotInfo():
 		t.cache = t.bt.storage.GetCache(t.Hash())
 		t.cache.SetTorrent(t.Torrent)
+		t.cache.SetFilePriorities(t.filePiecePriorities())
 		return true
 	case <-t.closed:
 		return false
@@ -201,6 +241,7 @@ func (t *Torrent) progressEvent() {
 
 	t.lastTimeSpeed = time.Now()
 	t.updateRA()
+	t.sendEvent()
 }
 
 func (t *Torrent) updateRA() {
@@ -222,6 +263,10 @@ func (t *Torrent) updateRA() {
 }
 
 func (t *Torrent) expired() bool {
+	if t.cache.IsKeep() && t.Stat == state.TorrentWorking && t.Torrent != nil && t.keepMissing() > 0 {
+		// keep torrent works until fully downloaded
+		return false
+	}
 	return t.cache.Readers() == 0 && t.expiredTime.Before(time.Now()) && (t.Stat == state.TorrentWorking || t.Stat == state.TorrentClosed)
 }
 
@@ -274,6 +319,7 @@ func (t *Torrent) drop() {
 		t.Torrent.Drop()
 		t.Torrent = nil
 	}
+	t.bt.storage.ClearHash(t.Hash())
 }
 
 func (t *Torrent) Close() bool {
@@ -281,6 +327,7 @@ func (t *Torrent) Close() bool {
 		return false
 	}
 	t.Stat = state.TorrentClosed
+	t.sendEvent()
 
 	t.bt.mu.Lock()
 	delete(t.bt.torrents, t.Hash())
@@ -294,6 +341,32 @@ func (t *Torrent) Status() *state.TorrentStatus {
 	t.muTorrent.Lock()
 	defer t.muTorrent.Unlock()
 
+	st := t.status()
+	if t.Torrent != nil && t.Torrent.Info() != nil {
+		infos := cachedMediaInfos(st.Hash)
+		for i, f := range t.sortedFiles() {
+			st.FileStats = append(st.FileStats, &state.TorrentFileStat{
+				Id:        i + 1, // in web id 0 is undefined
+				Path:      f.Path(),
+				Length:    f.Length(),
+				MediaInfo: infos[i+1],
+				Episode:   utils2.ParseEpisode(f.Path()),
+				Priority:  t.filePriority(i + 1),
+			})
+		}
+	}
+	return st
+}
+
+// StatsStatus returns status of torrent without file stats, for frequent polling of counters
+func (t *Torrent) StatsStatus() *state.TorrentStatus {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	return t.status()
+}
+
+// status returns status of torrent without file stats, must be called under muTorrent
+func (t *Torrent) status() *state.TorrentStatus {
 	st := new(state.TorrentStatus)
 
 	st.Stat = t.Stat
@@ -306,6 +379,8 @@ func (t *Torrent) Status() *state.TorrentStatus {
 	st.TorrentSize = t.Size
 	st.BitRate = t.BitRate
 	st.DurationSeconds = t.DurationSeconds
+	st.Keep = t.Keep
+	st.Tags = t.Tags
 
 	if t.TorrentSpec != nil {
 		st.Hash = t.TorrentSpec.InfoHash.HexString()
@@ -340,17 +415,11 @@ func (t *Torrent) Status() *state.TorrentStatus {
 
 		if t.Torrent.Info() != nil {
 			st.TorrentSize = t.Torrent.Length()
-
-			files := t.Files()
-			sort.Slice(files, func(i, j int) bool {
-				return utils2.CompareStrings(files[i].Path(), files[j].Path())
-			})
-			for i, f := range files {
-				st.FileStats = append(st.FileStats, &state.TorrentFileStat{
-					Id:     i + 1, // in web id 0 is undefined
-					Path:   f.Path(),
-					Length: f.Length(),
-				})
+			if t.Keep && st.TorrentSize > 0 {
+				// skipped files are not downloaded
+				if wanted := st.TorrentSize - t.skippedSize(); wanted > 0 {
+					st.KeepProgress = min(float64(st.LoadedSize)*100/float64(wanted), 100)
+				}
 			}
 		}
 	}
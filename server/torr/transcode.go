@@ -0,0 +1,188 @@
+package torr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"server/ffprobe"
+	"server/log"
+	sets "server/settings"
+)
+
+var transcodes atomic.Int32
+
+// TranscodeCodecs returns ffmpeg output codec options of profile
+func TranscodeCodecs(p *sets.TranscodeProfile) []string {
+	args := []string{"-map", "0:v:0?", "-map", "0:a:0?", "-sn", "-c:v", p.VideoCodec}
+	if p.VideoCodec != "copy" {
+		if p.VideoCodec == "libx264" {
+			args = append(args, "-preset", "veryfast", "-pix_fmt", "yuv420p")
+		}
+		if p.MaxHeight > 0 {
+			args = append(args, "-vf", "scale=-2:'min("+strconv.Itoa(p.MaxHeight)+",ih)'")
+		}
+		if p.VideoBitrate > 0 {
+			br := strconv.Itoa(p.VideoBitrate) + "k"
+			args = append(args, "-b:v", br, "-maxrate", br, "-bufsize", strconv.Itoa(p.VideoBitrate*2)+"k")
+		}
+	}
+	args = append(args, "-c:a", p.AudioCodec)
+	if p.AudioCodec != "copy" {
+		args = append(args, "-ac", "2")
+		if p.AudioBitrate > 0 {
+			args = append(args, "-b:a", strconv.Itoa(p.AudioBitrate)+"k")
+		}
+	}
+	return args
+}
+
+// AcquireTranscode reserves one of concurrent transcodes limited by TranscodeLimit,
+// ReleaseTranscode must be called when transcode ends
+func AcquireTranscode() bool {
+	if int(transcodes.Add(1)) > sets.TranscodeLimit() {
+		transcodes.Add(-1)
+		return false
+	}
+	return true
+}
+
+// ReleaseTranscode frees transcode reserved by AcquireTranscode
+func ReleaseTranscode() {
+	transcodes.Add(-1)
+}
+
+// Transcode streams file transcoded by ffmpeg with profile, ffmpeg reads file from torrent reader.
+// Size of transcoded stream is unknown, so byte ranges aren't supported, seek is set by time
+// with DLNA time seek or start query, on seek ffmpeg reads file from /play link to seek it by time.
+func (t *Torrent) Transcode(fileID int, profile *sets.TranscodeProfile, req *http.Request, resp http.ResponseWriter) error {
+	if !t.GotInfo() {
+		http.NotFound(resp, req)
+		return errors.New("torrent don't get info")
+	}
+	if !ffprobe.FFmpegExists() {
+		err := errors.New("ffmpeg not found")
+		http.Error(resp, err.Error(), http.StatusNotImplemented)
+		return err
+	}
+
+	file, err := t.streamFile(fileID)
+	if err != nil {
+		http.NotFound(resp, req)
+		return err
+	}
+
+	hash := t.Hash().HexString()
+	var duration float64
+	if info := cachedMediaInfo(hash, fileID); info != nil {
+		duration = info.Duration
+	}
+	start := transcodeStart(req, duration)
+	resp.Header().Set("Connection", "close")
+	resp.Header().Set("Content-Type", "video/mp2t")
+	resp.Header().Set("transferMode.dlna.org", "Streaming")
+	if start > 0 && req.Header.Get("TimeSeekRange.dlna.org") != "" {
+		resp.Header().Set("TimeSeekRange.dlna.org", fmt.Sprintf("npt=%.3f-", start))
+	}
+	if req.Method == http.MethodHead {
+		resp.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	if !AcquireTranscode() {
+		err := errors.New("too many transcodes")
+		http.Error(resp, err.Error(), http.StatusServiceUnavailable)
+		return err
+	}
+	defer ReleaseTranscode()
+
+	t.streamRequests.Add(1)
+	streamRequestsTotal.Add(1)
+	sets.SetViewed(&sets.Viewed{Hash: hash, FileIndex: fileID})
+
+	args := []string{"-i", "pipe:0"}
+	if start > 0 {
+		// pipe can't be seeked, ffmpeg seeks /play link by range requests
+		args = []string{"-ss", strconv.FormatFloat(start, 'f', 3, 64), "-i", LocalPlayLink(hash, fileID)}
+	}
+	args = append(args, TranscodeCodecs(profile)...)
+	if start > 0 {
+		args = append(args, "-output_ts_offset", strconv.FormatFloat(start, 'f', 3, 64))
+	}
+	args = append(args, "-f", "mpegts", "pipe:1")
+	cmd := ffprobe.FFmpeg(req.Context(), args...)
+	// ffmpeg killed on end of request can keep pipes open
+	cmd.WaitDelay = 5 * time.Second
+	cmd.Stdout = resp
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if start == 0 {
+		reader := t.NewReader(file)
+		if reader == nil {
+			http.NotFound(resp, req)
+			return errors.New("torrent closed")
+		}
+		if sets.BTsets.ResponsiveMode {
+			reader.SetResponsive()
+		}
+		// closed reader unblocks copy to stdin of ffmpeg when request ends
+		stop := context.AfterFunc(req.Context(), func() {
+			t.CloseReader(reader)
+		})
+		defer func() {
+			if stop() {
+				t.CloseReader(reader)
+			}
+		}()
+		cmd.Stdin = &streamReader{reader, t}
+	}
+
+	log.TLogln("Start transcode:", file.DisplayPath(), "profile:", profile.Name, "from:", start)
+	resp.WriteHeader(http.StatusOK)
+	err = cmd.Run()
+	if err != nil && req.Context().Err() == nil {
+		log.TLogln("Error transcode:", err, strings.TrimSpace(stderr.String()))
+	}
+	log.TLogln("End transcode:", file.DisplayPath())
+	return nil
+}
+
+// transcodeStart returns time in seconds to start transcode from by DLNA time seek or start query
+// in seconds or hh:mm:ss, time after duration of file is ignored if duration is known
+func transcodeStart(req *http.Request, duration float64) float64 {
+	from := req.URL.Query().Get("start")
+	if npt := req.Header.Get("TimeSeekRange.dlna.org"); strings.HasPrefix(npt, "npt=") {
+		from, _, _ = strings.Cut(strings.TrimPrefix(npt, "npt="), "-")
+	}
+	sec, ok := parseNpt(from)
+	if !ok || duration > 0 && sec >= duration {
+		return 0
+	}
+	return sec
+}
+
+// parseNpt parses DLNA normal play time: seconds or hh:mm:ss.sss
+func parseNpt(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	var sec float64
+	for _, part := range strings.Split(s, ":") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, false
+		}
+		sec = sec*60 + v
+	}
+	return sec, s != ""
+}
+
+// TranscodeCount returns count of running transcodes
+func TranscodeCount() int {
+	return int(transcodes.Load())
+}
@@ -99,3 +99,18 @@ func Limit(i int) *rate.Limiter {
 	}
 	return l
 }
+
+// SetLimit changes limit of limiter in place, 0 - inf
+func SetLimit(l *rate.Limiter, i int) {
+	if i > 0 {
+		b := i
+		if b < 16*1024 {
+			b = 16 * 1024
+		}
+		l.SetBurst(b)
+		l.SetLimit(rate.Limit(i))
+	} else {
+		l.SetLimit(rate.Inf)
+		l.SetBurst(0)
+	}
+}
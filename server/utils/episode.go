@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"server/torr/state"
+)
+
+var (
+	// S01E02, s1.e2, S01 E02
+	reSxE = regexp.MustCompile(`(?i)(?:^|[^\pL\d])s(\d{1,2})[ ._-]?e(\d{1,4})(?:[^\d]|$)`)
+	// 1x02
+	reNxN = regexp.MustCompile(`(?i)(?:^|[^\pL\d])(\d{1,2})x(\d{2,3})(?:[^\pL\d]|$)`)
+	// Серия 5, Episode 5, Ep05, Эпизод 5
+	reEpisode = regexp.MustCompile(`(?i)(?:^|[^\pL\d])(?:серия|эпизод|episode|ep)[ ._-]?(\d{1,4})(?:[^\d]|$)`)
+	// 5 серия
+	reEpisodeRu = regexp.MustCompile(`(?i)(?:^|[^\pL\d])(\d{1,4})[ ._-]?(?:серия|эпизод)`)
+	// Season 2, Сезон 2, 2 сезон, S02
+	reSeason = regexp.MustCompile(`(?i)(?:^|[^\pL\d])(?:(?:season|сезон)[ ._-]?(\d{1,2})|(\d{1,2})[ ._-]?(?:season|сезон)|s(\d{1,2}))(?:[^\pL\d]|$)`)
+	// episode number as whole file name: 05.mkv
+	reNumber = regexp.MustCompile(`^\d{1,3}$`)
+	reYear   = regexp.MustCompile(`(?:^|[^\pL\d])((?:19|20)\d{2})(?:[^\pL\d]|$)`)
+	reRes    = regexp.MustCompile(`(?i)(?:^|[^\pL\d])(2160p|1440p|1080p|1080i|720p|576p|480p|4k|uhd)(?:[^\pL\d]|$)`)
+)
+
+// ParseEpisode returns show, season, episode, year and resolution parsed from path
+// of video file, or nil if path has none of them
+func ParseEpisode(path string) *state.Episode {
+	if GetMimeType(path) != "video/*" {
+		return nil
+	}
+	path = filepath.ToSlash(path)
+	dirs := strings.Split(path, "/")
+	name := dirs[len(dirs)-1]
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	dirs = dirs[:len(dirs)-1]
+
+	ep := new(state.Episode)
+	showEnd := -1
+	if m := reSxE.FindStringSubmatchIndex(name); m != nil {
+		ep.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		ep.Episode, _ = strconv.Atoi(name[m[4]:m[5]])
+		showEnd = m[0]
+	} else if m := reNxN.FindStringSubmatchIndex(name); m != nil {
+		ep.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		ep.Episode, _ = strconv.Atoi(name[m[4]:m[5]])
+		showEnd = m[0]
+	} else if m := reEpisode.FindStringSubmatchIndex(name); m != nil {
+		ep.Episode, _ = strconv.Atoi(name[m[2]:m[3]])
+		showEnd = m[0]
+	} else if m := reEpisodeRu.FindStringSubmatchIndex(name); m != nil {
+		ep.Episode, _ = strconv.Atoi(name[m[2]:m[3]])
+		showEnd = m[0]
+	} else if reNumber.MatchString(name) {
+		ep.Episode, _ = strconv.Atoi(name)
+		showEnd = 0
+	}
+
+	if ep.Season == 0 {
+		// season of episode from file name or nearest folder: Show/Season 2/Серия 5.mkv
+		ep.Season = parseSeason(name)
+		for i := len(dirs) - 1; i >= 0 && ep.Season == 0; i-- {
+			ep.Season = parseSeason(dirs[i])
+		}
+	}
+
+	if ep.Episode > 0 {
+		if showEnd > 0 {
+			ep.Show = cleanTitle(name[:showEnd])
+		}
+		// name of nearest folder not being season folder: Show/Season 2/05.mkv
+		for i := len(dirs) - 1; i >= 0 && ep.Show == ""; i-- {
+			ep.Show = cleanTitle(dirs[i])
+		}
+	}
+
+	for _, s := range append([]string{name}, dirs...) {
+		if m := reYear.FindStringSubmatch(s); m != nil && ep.Year == 0 {
+			ep.Year, _ = strconv.Atoi(m[1])
+		}
+		if m := reRes.FindStringSubmatch(s); m != nil && ep.Resolution == "" {
+			ep.Resolution = strings.ToLower(m[1])
+			if ep.Resolution == "4k" || ep.Resolution == "uhd" {
+				ep.Resolution = "2160p"
+			}
+		}
+	}
+
+	if *ep == (state.Episode{}) {
+		return nil
+	}
+	return ep
+}
+
+func parseSeason(s string) int {
+	m := reSeason.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	for _, v := range m[1:] {
+		if v != "" {
+			n, _ := strconv.Atoi(v)
+			return n
+		}
+	}
+	return 0
+}
+
+// cleanTitle returns title cut before season, year or resolution, with dots and underscores replaced by spaces
+func cleanTitle(s string) string {
+	for _, re := range []*regexp.Regexp{reSeason, reYear, reRes} {
+		if loc := re.FindStringIndex(s); loc != nil {
+			s = s[:loc[0]]
+		}
+	}
+	s = strings.NewReplacer(".", " ", "_", " ").Replace(s)
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.Trim(s, " -([")
+}
+
+// SortEpisodes returns copy of files sorted by show, season and episode,
+// files without episode are sorted by path
+func SortEpisodes(files []*state.TorrentFileStat) []*state.TorrentFileStat {
+	type key struct {
+		group           string
+		season, episode int
+	}
+	keys := make(map[*state.TorrentFileStat]key, len(files))
+	for _, f := range files {
+		if f.Episode != nil && f.Episode.Episode > 0 {
+			keys[f] = key{strings.ToLower(f.Episode.Show), f.Episode.Season, f.Episode.Episode}
+		} else {
+			keys[f] = key{group: strings.ToLower(f.Path)}
+		}
+	}
+	ret := append([]*state.TorrentFileStat{}, files...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		ki, kj := keys[ret[i]], keys[ret[j]]
+		if ki.group != kj.group {
+			return CompareStrings(ki.group, kj.group)
+		}
+		if ki.season != kj.season {
+			return ki.season < kj.season
+		}
+		if ki.episode != kj.episode {
+			return ki.episode < kj.episode
+		}
+		return CompareStrings(ret[i].Path, ret[j].Path)
+	})
+	return ret
+}
+
+// Seasons returns sorted seasons of episodes in files
+func Seasons(files []*state.TorrentFileStat) []int {
+	seen := make(map[int]bool)
+	var ret []int
+	for _, f := range files {
+		if f.Episode != nil && f.Episode.Episode > 0 && f.Episode.Season > 0 && !seen[f.Episode.Season] {
+			seen[f.Episode.Season] = true
+			ret = append(ret, f.Episode.Season)
+		}
+	}
+	sort.Ints(ret)
+	return ret
+}
+
+// SeasonFiles returns files of episodes of season
+func SeasonFiles(files []*state.TorrentFileStat, season int) []*state.TorrentFileStat {
+	var ret []*state.TorrentFileStat
+	for _, f := range files {
+		if f.Episode != nil && f.Episode.Episode > 0 && f.Episode.Season == season {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
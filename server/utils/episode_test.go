@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"testing"
+
+	"server/torr/state"
+)
+
+func TestParseEpisode(t *testing.T) {
+	tests := []struct {
+		path string
+		want *state.Episode
+	}{
+		{"Show.S01E02.1080p.mkv", &state.Episode{Show: "Show", Season: 1, Episode: 2, Resolution: "1080p"}},
+		{"Show.s1.e2.mkv", &state.Episode{Show: "Show", Season: 1, Episode: 2}},
+		{"Show 1x02.avi", &state.Episode{Show: "Show", Season: 1, Episode: 2}},
+		{"Серия 5.mkv", &state.Episode{Episode: 5}},
+		{"5 серия.mkv", &state.Episode{Episode: 5}},
+		{"Сериал/Сезон 2/05.mkv", &state.Episode{Show: "Сериал", Season: 2, Episode: 5}},
+		{"Show/Season 2/Серия 5.mkv", &state.Episode{Show: "Show", Season: 2, Episode: 5}},
+		{"Movie.2019.2160p.mkv", &state.Episode{Year: 2019, Resolution: "2160p"}},
+		// resolution and codec are not episodes
+		{"Movie.1920x1080.mkv", nil},
+		{"Movie.x264.mkv", nil},
+		{"Show.S01E02.srt", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := ParseEpisode(tt.path)
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("ParseEpisode(%q) = %+v, want %+v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortEpisodes(t *testing.T) {
+	paths := []string{
+		"Show/Season 2/Серия 1.mkv",
+		"Show/Season 1/Серия 10.mkv",
+		"Extras.mkv",
+		"Show/Season 1/Серия 2.mkv",
+		"Show/Season 1/Серия 1.mkv",
+	}
+	want := []string{
+		"Extras.mkv",
+		"Show/Season 1/Серия 1.mkv",
+		"Show/Season 1/Серия 2.mkv",
+		"Show/Season 1/Серия 10.mkv",
+		"Show/Season 2/Серия 1.mkv",
+	}
+	files := make([]*state.TorrentFileStat, 0, len(paths))
+	for i, p := range paths {
+		files = append(files, &state.TorrentFileStat{Id: i + 1, Path: p, Episode: ParseEpisode(p)})
+	}
+	got := SortEpisodes(files)
+	if len(got) != len(want) {
+		t.Fatalf("SortEpisodes returned %d files, want %d", len(got), len(want))
+	}
+	for i, f := range got {
+		if f.Path != want[i] {
+			t.Errorf("SortEpisodes()[%d] = %q, want %q", i, f.Path, want[i])
+		}
+	}
+	if files[0].Path != paths[0] {
+		t.Error("SortEpisodes changed order of files passed")
+	}
+}
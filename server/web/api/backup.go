@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	sets "server/settings"
+	"server/torr"
+	"server/web/auth"
+)
+
+// backup godoc
+//
+//	@Summary		Backup server data
+//	@Description	Get zip archive with settings, torrents, viewed files and users. Only for admin role.
+//
+//	@Tags			API
+//
+//	@Produce		application/zip
+//	@Success		200	{file}	file
+//	@Router			/backup [get]
+func backup(c *gin.Context) {
+	var buf bytes.Buffer
+	if err := sets.Backup(&buf); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	name := "torrserver_backup_" + time.Now().Format("20060102_150405") + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Data(200, "application/zip", buf.Bytes())
+}
+
+// restore godoc
+//
+//	@Summary		Restore server data
+//	@Description	Restore zip archive of backup to running server. Only for admin role.
+//
+//	@Tags			API
+//
+//	@Param			file		formData	file	true	"Backup archive"
+//	@Param			strategy	formData	string	false	"Strategy for existing data: skip, merge (default) or overwrite"
+//
+//	@Accept			multipart/form-data
+//
+//	@Produce		json
+//	@Success		200	{object}	sets.RestoreResult	"Restored entries by sections"
+//	@Router			/backup [post]
+func restore(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+	if sets.ReadOnly {
+		c.AbortWithError(http.StatusForbidden, errors.New("read-only DB mode"))
+		return
+	}
+
+	res, err := sets.Restore(file, header.Size, c.Request.FormValue("strategy"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	// torrents removed from DB are removed from BT client, updated ones are reloaded from DB
+	for _, hash := range res.RemovedTorrents {
+		torr.RemTorrent(hash)
+	}
+	for _, hash := range res.UpdatedTorrents {
+		torr.DropTorrent(hash)
+	}
+	auth.ResetVerified()
+	if res.Sets != nil {
+		setSettings(res.Sets)
+	}
+	c.JSON(200, res)
+}
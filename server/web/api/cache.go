@@ -9,7 +9,7 @@ import (
 	"github.com/pkg/errors"
 )
 
-// Action: get
+// Action: get, usage
 type cacheReqJS struct {
 	requestI
 	Hash string `json:"hash,omitempty"`
@@ -22,7 +22,7 @@ type cacheReqJS struct {
 //
 //	@Tags			API
 //
-//	@Param			request	body	cacheReqJS	true	"Cache stats request"
+//	@Param			request	body	cacheReqJS	true	"Cache stats request. Available params for action: get, usage. hash required for get."
 //
 //	@Produce		json
 //	@Success		200	{object} state.CacheState	"Cache stats"
@@ -40,6 +40,10 @@ func cache(c *gin.Context) {
 		{
 			getCache(req, c)
 		}
+	case "usage":
+		{
+			c.JSON(200, torr.DiskCacheState())
+		}
 	}
 }
 
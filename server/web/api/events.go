@@ -0,0 +1,53 @@
+package api
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"server/torr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// torrentEvents godoc
+//
+//	@Summary		Stream torrents status changes
+//	@Description	Server-Sent Events stream of active torrents status changes. First event of every torrent contains all fields, next events contain only changed fields.
+//
+//	@Tags			API
+//
+//	@Param			hash	query	string	false	"Comma separated hashes of torrents to subscribe, all torrents if empty"
+//
+//	@Produce		text/event-stream
+//	@Success		200	{object}	torr.TorrentEvent	"Torrent status changes"
+//	@Router			/torrents/events [get]
+func torrentEvents(c *gin.Context) {
+	var hashes []string
+	for _, h := range c.QueryArray("hash") {
+		for _, hash := range strings.Split(h, ",") {
+			hashes = append(hashes, strings.ToLower(strings.TrimSpace(hash)))
+		}
+	}
+
+	sub := torr.Subscribe(hashes)
+	defer torr.Unsubscribe(sub)
+
+	ping := time.NewTicker(15 * time.Second)
+	defer ping.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev := <-sub.C:
+			c.SSEvent("torrent", ev)
+			return true
+		case <-ping.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
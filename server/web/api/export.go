@@ -0,0 +1,141 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"server/log"
+	"server/torr"
+	"server/torr/state"
+)
+
+// exportTorrent godoc
+//
+//	@Summary		Export torrent file
+//	@Description	Get .torrent file of torrent with info and current trackers.
+//
+//	@Tags			API
+//
+//	@Param			hash	path	string	true	"Torrent hash with .torrent extension"
+//
+//	@Produce		application/x-bittorrent
+//	@Success		200	{file}	file
+//	@Router			/torrent/{hash}.torrent [get]
+func exportTorrent(c *gin.Context) {
+	hash := strings.TrimSuffix(c.Param("hash"), ".torrent")
+	if hash == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("hash is empty"))
+		return
+	}
+	tor := torr.GetTorrent(hash)
+	if tor == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	mi := tor.MetaInfo()
+	if mi == nil && tor.Stat == state.TorrentInDB {
+		// magnet saved without info, info is loaded from peers
+		if tor = torr.LoadTorrent(tor); tor != nil {
+			mi = tor.MetaInfo()
+		}
+	}
+	if mi == nil {
+		c.AbortWithError(http.StatusNotFound, errors.New("torrent info is not loaded"))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Content-Disposition", attachment(torrentFileName(tor.Title, hash)))
+	c.Data(200, "application/x-bittorrent", buf.Bytes())
+}
+
+// exportTorrents godoc
+//
+//	@Summary		Export all torrent files
+//	@Description	Get zip of .torrent files of all torrents. Torrents without loaded info are skipped.
+//
+//	@Tags			API
+//
+//	@Produce		application/zip
+//	@Success		200	{file}	file
+//	@Router			/torrents/export [get]
+func exportTorrents(c *gin.Context) {
+	// zip is streamed to client, errors after start of response only break it
+	c.Header("Content-Disposition", attachment("torrents.zip"))
+	c.Header("Content-Type", "application/zip")
+	c.Status(200)
+	zw := zip.NewWriter(c.Writer)
+	names := make(map[string]bool)
+	for _, tor := range torr.ListTorrent() {
+		hash := tor.TorrentSpec.InfoHash.HexString()
+		mi := tor.MetaInfo()
+		if mi == nil {
+			log.TLogln("Skip export of torrent without info:", hash, tor.Title)
+			continue
+		}
+		name := torrentFileName(tor.Title, hash)
+		if names[strings.ToLower(name)] {
+			name = torrentFileName(tor.Title+" "+hash, hash)
+		}
+		names[strings.ToLower(name)] = true
+
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Unix(tor.Timestamp, 0)})
+		if err == nil {
+			err = mi.Write(w)
+		}
+		if err != nil {
+			log.TLogln("Error export torrents:", err)
+			c.Abort()
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.TLogln("Error export torrents:", err)
+		c.Abort()
+	}
+}
+
+// attachment returns Content-Disposition of file with ASCII name and RFC 5987 UTF-8 name
+func attachment(name string) string {
+	var ascii, ext strings.Builder
+	for _, r := range name {
+		if r < ' ' || r > '~' || r == '"' || r == '\\' {
+			ascii.WriteByte('_')
+		} else {
+			ascii.WriteRune(r)
+		}
+	}
+	for _, b := range []byte(name) {
+		if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || strings.IndexByte("!#$&+-.^_`|~", b) >= 0 {
+			ext.WriteByte(b)
+		} else {
+			fmt.Fprintf(&ext, "%%%02X", b)
+		}
+	}
+	return `attachment; filename="` + ascii.String() + `"; filename*=UTF-8''` + ext.String()
+}
+
+// torrentFileName returns title of torrent as file name with .torrent extension
+func torrentFileName(title, hash string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = hash
+	}
+	return name + ".torrent"
+}
@@ -4,9 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"server/ffprobe"
-	sets "server/settings"
+	"server/torr"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,12 +34,8 @@ func ffp(c *gin.Context) {
 		return
 	}
 
-	link := "http://127.0.0.1:" + sets.Port + "/play/" + hash + "/" + indexStr
-	if sets.Ssl {
-		link = "https://127.0.0.1:" + sets.SslPort + "/play/" + hash + "/" + indexStr
-	}
-
-	data, err := ffprobe.ProbeUrl(link)
+	index, _ := strconv.Atoi(indexStr)
+	data, err := ffprobe.ProbeUrl(torr.LocalPlayLink(hash, index))
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("error getting data: %v", err))
 		return
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"server/hls"
+	sets "server/settings"
+	"server/torr"
+)
+
+// hlsStream godoc
+//
+//	@Summary		Remux torrent file to HLS
+//	@Description	Remux torrent file to HLS with ffmpeg without transcoding or transcode it by profile. Open master.m3u8, segments are served by the same path.
+//
+//	@Tags			API
+//
+//	@Param			hash	path	string	true	"Torrent hash"
+//	@Param			id		path	string	true	"File index in torrent"
+//	@Param			file	path	string	true	"master.m3u8, index.m3u8 or segment name"
+//	@Param			exp		query	string	false	"Signed link expiration, unix time"
+//	@Param			sig		query	string	false	"Signed link signature, allows play without auth"
+//	@Param			profile	query	string	false	"Transcode profile, remux without transcoding if empty"
+//
+//	@Produce		application/vnd.apple.mpegurl
+//	@Success		200	"HLS playlist or segment"
+//	@Router			/hls/{hash}/{id}/{file} [get]
+func hlsStream(c *gin.Context) {
+	hash := strings.ToLower(c.Param("hash"))
+	indexStr := c.Param("id")
+	file := c.Param("file")
+	notAuth := c.GetBool("auth_required") && c.GetString(gin.AuthUserKey) == ""
+
+	index, err := strconv.Atoi(indexStr)
+	if hash == "" || err != nil {
+		c.AbortWithError(http.StatusNotFound, errors.New("link should not be empty"))
+		return
+	}
+
+	query := url.Values{}
+	if notAuth {
+		if !sets.CheckStreamToken(hash, index, c.Query("exp"), c.Query("sig")) {
+			c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		query.Set("exp", c.Query("exp"))
+		query.Set("sig", c.Query("sig"))
+	}
+
+	if torr.GetTorrent(hash) == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	key := hash + "/" + indexStr
+	codecs := hls.CopyCodecs
+	var acquire func() bool
+	var release func()
+	if name := c.Query("profile"); name != "" && name != "none" {
+		profile := sets.GetTranscodeProfile(name)
+		if profile == nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("unknown transcode profile"))
+			return
+		}
+		query.Set("profile", profile.Name)
+		key += "/" + profile.Name
+		codecs = torr.TranscodeCodecs(profile)
+		acquire, release = torr.AcquireTranscode, torr.ReleaseTranscode
+	}
+	if file == "master.m3u8" {
+		list := "#EXTM3U\n#EXT-X-VERSION:3\n"
+		list += fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d\n", hlsBandwidth(hash))
+		list += hls.IndexName + hlsQuery(query) + "\n"
+		sendHLS(c, []byte(list))
+		return
+	}
+	if file != hls.IndexName && !hls.IsSegment(file) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	// one ffmpeg of session writes all segments, session is started again after idle timeout
+	if err := hls.Start(key, torr.LocalPlayLink(hash, index), codecs, acquire, release); err != nil {
+		if errors.Is(err, hls.ErrBusy) {
+			c.AbortWithError(http.StatusServiceUnavailable, err)
+		} else {
+			c.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	if file == hls.IndexName {
+		// reads of ffmpeg from /play link are internal, playlist request is playback of user
+		sets.SetViewed(&sets.Viewed{Hash: hash, FileIndex: index})
+		list, err := hls.Playlist(c.Request.Context(), key)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		sendHLS(c, hlsRewrite(list, hlsQuery(query)))
+		return
+	}
+	name, err := hls.Segment(c.Request.Context(), key, file)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Header("Content-Type", "video/mp2t")
+	c.File(name)
+}
+
+func sendHLS(c *gin.Context, list []byte) {
+	c.Header("Cache-Control", "no-cache")
+	c.Data(200, "application/vnd.apple.mpegurl", list)
+}
+
+// hlsRewrite makes segments of playlist relative and appends signed link query to them
+func hlsRewrite(list []byte, query string) []byte {
+	var ret bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(list))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" && !strings.HasPrefix(line, "#") {
+			line = filepath.Base(line) + query
+		}
+		ret.WriteString(line + "\n")
+	}
+	return ret.Bytes()
+}
+
+func hlsQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+func hlsBandwidth(hash string) int64 {
+	if tor := torr.GetTorrent(hash); tor != nil {
+		if br, err := strconv.ParseInt(tor.BitRate, 10, 64); err == nil && br > 0 {
+			return br
+		}
+	}
+	return 8 * 1000 * 1000
+}
@@ -7,13 +7,13 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 
 	"github.com/anacrolix/missinggo/v2/httptoo"
 
 	sets "server/settings"
+	"server/subs"
 	"server/torr"
 	"server/torr/state"
 	"server/utils"
@@ -45,7 +45,7 @@ func allPlayList(c *gin.Context) {
 			list += " tvg-logo=\"" + tr.Poster + "\""
 		}
 		list += " type=\"playlist\"," + tr.Title + "\n"
-		list += host + "/stream/" + url.PathEscape(tr.Title) + ".m3u?link=" + tr.TorrentSpec.InfoHash.HexString() + "&m3u&fn=file.m3u\n"
+		list += host + "/stream/" + url.PathEscape(tr.Title) + ".m3u?link=" + tr.TorrentSpec.InfoHash.HexString() + "&m3u" + sets.StreamLinkToken(tr.TorrentSpec.InfoHash.HexString(), 0) + "&fn=file.m3u\n"
 		hash += tr.Hash().HexString()
 	}
 
@@ -115,33 +115,60 @@ func sendM3U(c *gin.Context, name, hash string, m3u string) {
 }
 
 func getM3uList(tor *state.TorrentStatus, host string, fromLast bool) string {
-	m3u := ""
 	from := 0
+	var last *sets.Viewed
+	files := utils.SortEpisodes(tor.FileStats) // episodes of series in order of seasons
 	if fromLast {
-		pos := searchLastPlayed(tor)
+		pos, vv := searchLastPlayed(tor.Hash, files)
 		if pos != -1 {
 			from = pos
+			last = vv
 		}
 	}
-	for i, f := range tor.FileStats {
+	return getM3uFiles(tor, files, host, from, last)
+}
+
+// getM3uFiles returns m3u list of media files starting from position from,
+// first file is resumed from last position if set
+func getM3uFiles(tor *state.TorrentStatus, files []*state.TorrentFileStat, host string, from int, last *sets.Viewed) string {
+	m3u := ""
+	for i, f := range files {
 		if i >= from {
-			if utils.GetMimeType(f.Path) != "*/*" {
+			if utils.GetMimeType(f.Path) != "*/*" && f.Priority != sets.FilePrioritySkip {
 				fn := filepath.Base(f.Path)
 				if fn == "" {
 					fn = f.Path
 				}
 				m3u += "#EXTINF:0," + fn + "\n"
-				fileNamesakes := findFileNamesakes(tor.FileStats, f) // find external media with same name (audio/subtiles tracks)
+				if i == from && last != nil && last.Seconds > 0 && (last.Length == 0 || last.Offset < last.Length) {
+					m3u += "#EXTVLCOPT:start-time=" + fmt.Sprint(int64(last.Seconds)) + "\n" // resume from saved position
+				}
+				fileNamesakes := findFileNamesakes(tor.FileStats, f) // find external media with same name (audio tracks)
+				var sidecars []*subs.Sidecar
+				if utils.GetMimeType(f.Path) == "video/*" {
+					sidecars = subs.MatchSidecars(tor.FileStats, f) // find subtitles files paired with video
+				}
+				for i, sidecar := range sidecars {
+					if i > 0 { // first subtitles file is set by sub-file, others are added as external media
+						fileNamesakes = append(fileNamesakes, sidecar.TorrentFileStat)
+					}
+				}
 				if fileNamesakes != nil {
 					m3u += "#EXTVLCOPT:input-slave="         // include VLC option for external media
 					for _, namesake := range fileNamesakes { // include play-links to external media, with # splitter
 						sname := filepath.Base(namesake.Path)
-						m3u += host + "/stream/" + url.PathEscape(sname) + "?link=" + tor.Hash + "&index=" + fmt.Sprint(namesake.Id) + "&play#"
+						m3u += host + "/stream/" + url.PathEscape(sname) + "?link=" + tor.Hash + "&index=" + fmt.Sprint(namesake.Id) + "&play" + sets.StreamLinkToken(tor.Hash, namesake.Id) + "#"
 					}
 					m3u += "\n"
 				}
+				if len(sidecars) > 0 {
+					sname := filepath.Base(sidecars[0].Path)
+					m3u += "#EXTVLCOPT:sub-file=" + host + "/stream/" + url.PathEscape(sname) + "?link=" + tor.Hash + "&index=" + fmt.Sprint(sidecars[0].Id) + "&play" + sets.StreamLinkToken(tor.Hash, sidecars[0].Id) + "\n"
+				} else if tracks := subs.List(tor.Hash, tor.FileStats, f.Id, false); len(tracks) > 0 {
+					m3u += "#EXTVLCOPT:sub-file=" + host + "/" + subs.Path(tor.Hash, f.Id, tracks[0].Id, "srt") + "\n"
+				}
 				name := filepath.Base(f.Path)
-				m3u += host + "/stream/" + url.PathEscape(name) + "?link=" + tor.Hash + "&index=" + fmt.Sprint(f.Id) + "&play\n"
+				m3u += host + "/stream/" + url.PathEscape(name) + "?link=" + tor.Hash + "&index=" + fmt.Sprint(f.Id) + "&play" + sets.StreamLinkToken(tor.Hash, f.Id) + "\n"
 			}
 		}
 	}
@@ -153,7 +180,7 @@ func findFileNamesakes(files []*state.TorrentFileStat, file *state.TorrentFileSt
 	name := filepath.Base(strings.TrimSuffix(file.Path, filepath.Ext(file.Path)))
 	var namesakes []*state.TorrentFileStat
 	for _, f := range files {
-		if strings.Contains(f.Path, name) { // external tracks always include name of videofile
+		if strings.Contains(f.Path, name) && !subs.IsSub(f.Path) { // external tracks always include name of videofile, subtitles are paired separately
 			if f != file { // exclude itself
 				namesakes = append(namesakes, f)
 			}
@@ -162,25 +189,26 @@ func findFileNamesakes(files []*state.TorrentFileStat, file *state.TorrentFileSt
 	return namesakes
 }
 
-func searchLastPlayed(tor *state.TorrentStatus) int {
-	viewed := sets.ListViewed(tor.Hash)
-	if len(viewed) == 0 {
-		return -1
+func searchLastPlayed(hash string, files []*state.TorrentFileStat) (int, *sets.Viewed) {
+	// prefer file with last saved playback position
+	if last := sets.LastPosition(hash); last != nil {
+		for i, stat := range files {
+			if stat.Id == last.FileIndex {
+				return i, last
+			}
+		}
 	}
-	sort.Slice(viewed, func(i, j int) bool {
-		return viewed[i].FileIndex > viewed[j].FileIndex
-	})
 
-	lastViewedIndex := viewed[0].FileIndex
-
-	for i, stat := range tor.FileStats {
-		if stat.Id == lastViewedIndex {
-			if i >= len(tor.FileStats) {
-				return -1
-			}
-			return i
+	// otherwise last viewed file in playlist order
+	viewed := make(map[int]bool)
+	for _, vv := range sets.ListViewed(hash) {
+		viewed[vv.FileIndex] = true
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		if viewed[files[i].Id] {
+			return i, nil
 		}
 	}
 
-	return -1
+	return -1, nil
 }
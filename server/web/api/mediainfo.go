@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"server/torr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mediaInfo godoc
+//
+//	@Summary		Get media info of file
+//	@Description	Get duration, video, audio and subtitles tracks and chapters of file, probed by ffprobe once and kept in DB.
+//
+//	@Tags			API
+//
+//	@Param			hash	path	string	true	"Torrent hash"
+//	@Param			id		path	string	true	"File index in torrent"
+//
+//	@Produce		json
+//	@Success		200	{object}	state.MediaInfo	"Media info"
+//	@Router			/mediainfo/{hash}/{id} [get]
+func mediaInfo(c *gin.Context) {
+	hash := c.Param("hash")
+	index, err := strconv.Atoi(c.Param("id"))
+
+	if hash == "" || err != nil {
+		c.AbortWithError(http.StatusNotFound, errors.New("link should not be empty"))
+		return
+	}
+	if torr.GetTorrent(hash) == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	info, err := torr.GetMediaInfo(hash, index, true)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("error getting data: %v", err))
+		return
+	}
+	c.JSON(200, info)
+}
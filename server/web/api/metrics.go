@@ -0,0 +1,23 @@
+package api
+
+import (
+	"server/torr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metrics godoc
+//
+//	@Summary		Prometheus metrics
+//	@Description	Metrics of active torrents, caches and streams in Prometheus text format.
+//
+//	@Tags			API
+//
+//	@Produce		plain
+//	@Success		200	"Metrics"
+//	@Router			/metrics [get]
+func metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(200)
+	torr.WriteMetrics(c.Writer)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	sets "server/settings"
+)
+
+type migrationJS struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied int64  `json:"applied,omitempty"`
+	Changes int    `json:"changes"`
+}
+
+type migrationsJS struct {
+	Version    int            `json:"version"`
+	Latest     int            `json:"latest"`
+	Migrations []*migrationJS `json:"migrations"`
+}
+
+// migrations godoc
+//
+//	@Summary		DB migrations status
+//	@Description	Get current DB schema version, latest version and list of migrations with time they were applied. Only for admin role.
+//
+//	@Tags			API
+//
+//	@Produce		json
+//	@Success		200	{object}	migrationsJS
+//	@Router			/migrations [get]
+func migrations(c *gin.Context) {
+	res := &migrationsJS{
+		Version:    sets.SchemaVersion(),
+		Latest:     sets.LatestSchemaVersion(),
+		Migrations: []*migrationJS{},
+	}
+	for _, st := range sets.ListMigrations() {
+		res.Migrations = append(res.Migrations, &migrationJS{
+			Version: st.Version,
+			Name:    st.Name,
+			Applied: st.Applied,
+			Changes: len(st.Changes),
+		})
+	}
+	c.JSON(200, res)
+}
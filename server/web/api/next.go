@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	sets "server/settings"
+	"server/torr"
+	"server/torr/state"
+	utils2 "server/utils"
+	"server/web/api/utils"
+)
+
+// playNext godoc
+//
+//	@Summary		Play next episode of torrent
+//	@Description	Redirect to play link of next unwatched media file in order of episodes, next.m3u returns playlist from it.
+//
+//	@Tags			API
+//
+//	@Param			hash		path	string	true	"Torrent hash"
+//	@Param			after		query	string	false	"File index, next file is searched after it, by default after last played file"
+//	@Param			exp			query	string	false	"Signed link expiration, unix time"
+//	@Param			sig			query	string	false	"Signed link signature of torrent (index 0), allows play without auth"
+//	@Param			profile		query	string	false	"Transcode profile of play link"
+//
+//	@Produce		audio/x-mpegurl
+//	@Success		302	"Redirect to play link"
+//	@Router			/play/{hash}/next [get]
+func playNext(c *gin.Context) {
+	hash := c.Param("hash")
+	notAuth := c.GetBool("auth_required") && c.GetString(gin.AuthUserKey) == ""
+
+	spec, err := utils.ParseLink(hash)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	hash = spec.InfoHash.HexString()
+
+	if notAuth && !sets.CheckStreamToken(hash, 0, c.Query("exp"), c.Query("sig")) {
+		c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	tor := torr.GetTorrent(hash)
+	if tor == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if tor.Stat == state.TorrentInDB {
+		tor = torr.LoadTorrent(tor)
+		if tor == nil {
+			c.AbortWithError(http.StatusInternalServerError, errors.New("error get torrent info"))
+			return
+		}
+	}
+
+	after, _ := strconv.Atoi(c.Query("after"))
+	st := tor.Status()
+	files := utils2.SortEpisodes(st.FileStats)
+	pos := nextEpisode(hash, files, after)
+	if pos == -1 {
+		c.AbortWithError(http.StatusNotFound, errors.New("next file not found"))
+		return
+	}
+
+	if c.Param("id") == "next.m3u" {
+		// without etag, list changes with viewed files
+		host := utils2.GetScheme(c) + "://" + c.Request.Host
+		sendM3U(c, tor.Name()+".m3u", "", "#EXTM3U\n"+getM3uFiles(st, files, host, pos, nil))
+		return
+	}
+
+	id := files[pos].Id
+	query := url.Values{}
+	if profile := c.Query("profile"); profile != "" {
+		query.Set("profile", profile)
+	}
+	link := "/play/" + hash + "/" + strconv.Itoa(id)
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	if sets.HttpAuth {
+		if len(query) > 0 {
+			link += "&"
+		} else {
+			link += "?"
+		}
+		link += sets.StreamToken(hash, id)
+	}
+	c.Redirect(http.StatusFound, link)
+}
+
+// nextEpisode returns position in files of next unwatched media file after file with id after,
+// or after last played file if after is 0. If all next files are viewed the nearest one is returned,
+// -1 if there are no next media files
+func nextEpisode(hash string, files []*state.TorrentFileStat, after int) int {
+	start := 0
+	if after > 0 {
+		start = -1
+		for i, f := range files {
+			if f.Id == after {
+				start = i + 1
+				break
+			}
+		}
+		if start == -1 {
+			return -1
+		}
+	} else if pos, _ := searchLastPlayed(hash, files); pos != -1 {
+		start = pos + 1
+	}
+
+	viewed := make(map[int]bool)
+	for _, vv := range sets.ListViewed(hash) {
+		viewed[vv.FileIndex] = true
+	}
+	next := -1
+	for i := start; i < len(files); i++ {
+		if utils2.GetMimeType(files[i].Path) == "*/*" || files[i].Priority == sets.FilePrioritySkip {
+			continue
+		}
+		if !viewed[files[i].Id] {
+			return i
+		}
+		if next == -1 {
+			next = i
+		}
+	}
+	return next
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	sets "server/settings"
 	"server/torr"
 	"server/torr/state"
 	"server/web/api/utils"
@@ -21,6 +22,10 @@ import (
 //
 //	@Param			hash		path	string	true	"Torrent hash"
 //	@Param			id			path	string	true	"File index in torrent"
+//	@Param			exp			query	string	false	"Signed link expiration, unix time"
+//	@Param			sig			query	string	false	"Signed link signature, allows play without auth"
+//	@Param			profile		query	string	false	"Transcode profile, none - disable profile selected by User-Agent"
+//	@Param			start		query	string	false	"Start time of transcode, seconds or hh:mm:ss"
 //
 //	@Produce		application/octet-stream
 //	@Success		200	"Torrent data"
@@ -35,12 +40,26 @@ func play(c *gin.Context) {
 		return
 	}
 
+	if indexStr == "next" || indexStr == "next.m3u" {
+		playNext(c)
+		return
+	}
+
 	spec, err := utils.ParseLink(hash)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
+	if notAuth {
+		ind, _ := strconv.Atoi(indexStr)
+		if !sets.CheckStreamToken(spec.InfoHash.HexString(), ind, c.Query("exp"), c.Query("sig")) {
+			c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+	}
+
 	tor := torr.GetTorrent(spec.InfoHash.HexString())
 	if tor == nil && notAuth {
 		c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
@@ -81,5 +100,5 @@ func play(c *gin.Context) {
 		return
 	}
 
-	tor.Stream(index, c.Request, c.Writer)
+	streamFile(c, tor, index)
 }
@@ -14,17 +14,31 @@ type requestI struct {
 func SetupRoute(route gin.IRouter) {
 	authorized := route.Group("/", auth.CheckAuth())
 
-	authorized.GET("/shutdown", shutdown)
-	authorized.GET("/shutdown/*reason", shutdown)
+	admin := authorized.Group("/", auth.CheckRole(config.RoleAdmin))
+	uploader := authorized.Group("/", auth.CheckRole(config.RoleUploader))
 
-	authorized.POST("/settings", settings)
+	admin.GET("/shutdown", shutdown)
+	admin.GET("/shutdown/*reason", shutdown)
+
+	admin.POST("/settings", settings)
+
+	admin.POST("/users", users)
+
+	admin.GET("/backup", backup)
+	admin.POST("/backup", restore)
+	admin.GET("/migrations", migrations)
 
 	authorized.POST("/torrents", torrents)
+	authorized.GET("/torrents/events", torrentEvents)
+	authorized.GET("/torrents/export", exportTorrents)
+	authorized.GET("/torrent/:hash", exportTorrent)
 
-	authorized.POST("/torrent/upload", torrentUpload)
+	uploader.POST("/torrent/upload", torrentUpload)
 
 	authorized.POST("/cache", cache)
 
+	authorized.GET("/metrics", metrics)
+
 	route.HEAD("/stream", stream)
 	route.GET("/stream", stream)
 
@@ -34,6 +48,13 @@ func SetupRoute(route gin.IRouter) {
 	route.HEAD("/play/:hash/:id", play)
 	route.GET("/play/:hash/:id", play)
 
+	route.GET("/hls/:hash/:id/:file", hlsStream)
+
+	route.GET("/subs/:hash/:id", subtitles)
+	route.GET("/subs/:hash/:id/:track", subtitles)
+
+	route.GET("/thumb/:hash/:id", thumb)
+
 	authorized.POST("/viewed", viewed)
 
 	authorized.GET("/playlistall/all.m3u", allPlayList)
@@ -50,4 +71,5 @@ func SetupRoute(route gin.IRouter) {
 	}
 
 	authorized.GET("/ffp/:hash/:id", ffp)
+	authorized.GET("/mediainfo/:hash/:id", mediaInfo)
 }
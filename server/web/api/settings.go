@@ -31,7 +31,7 @@ type setsReqJS struct {
 //
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	sets.BTSets	"Settings JSON or nothing. Depends on what action has been asked."
+//	@Success		200	{object}	sets.BTSets	"Settings JSON for get, changed settings for set, nothing for def."
 //	@Router			/settings [post]
 func settings(c *gin.Context) {
 	var req setsReqJS
@@ -45,14 +45,16 @@ func settings(c *gin.Context) {
 		c.JSON(200, sets.BTsets)
 		return
 	} else if req.Action == "set" {
-		torr.SetSettings(req.Sets)
-		dlna.Stop()
-		if req.Sets.EnableDLNA {
-			dlna.Start()
+		if req.Sets == nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("sets is empty"))
+			return
 		}
-		rutor.Stop()
-		rutor.Start()
-		c.Status(200)
+		res := setSettings(req.Sets)
+		if res == nil {
+			c.Status(200)
+			return
+		}
+		c.JSON(200, res)
 		return
 	} else if req.Action == "def" {
 		torr.SetDefSettings()
@@ -63,3 +65,22 @@ func settings(c *gin.Context) {
 	}
 	c.AbortWithError(http.StatusBadRequest, errors.New("action is empty"))
 }
+
+// setSettings saves and applies settings, restarts DLNA and search if their settings changed
+func setSettings(set *sets.BTSets) *torr.SettingsResult {
+	res := torr.SetSettings(set)
+	if res == nil {
+		return nil
+	}
+	if len(res.Restart) > 0 || res.Has("EnableDLNA", "FriendlyName") {
+		dlna.Stop()
+		if sets.BTsets.EnableDLNA {
+			dlna.Start()
+		}
+	}
+	if res.Has("EnableRutorSearch") {
+		rutor.Stop()
+		rutor.Start()
+	}
+	return res
+}
@@ -6,10 +6,12 @@ import (
 	"strconv"
 	"strings"
 
+	sets "server/settings"
 	"server/torr"
 	"server/torr/state"
 	utils2 "server/utils"
 	"server/web/api/utils"
+	"server/web/auth"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
@@ -27,6 +29,8 @@ import (
 // http://127.0.0.1:8090/stream/fname?link=...&index=1&play&save&title=...&poster=...
 // only save
 // http://127.0.0.1:8090/stream/fname?link=...&save&title=...&poster=...
+// signed link without auth, exp and sig generated by server
+// http://127.0.0.1:8090/stream/fname?link=...&index=1&play&exp=...&sig=...
 
 // stream godoc
 //
@@ -46,6 +50,10 @@ import (
 //	@Param			title		query	string	false	"Set title of torrent"
 //	@Param			poster		query	string	false	"Set poster link of torrent"
 //	@Param			category	query	string	false	"Set category of torrent, used in web: movie, tv, music, other"
+//	@Param			exp			query	string	false	"Signed link expiration, unix time"
+//	@Param			sig			query	string	false	"Signed link signature, allows play and m3u without auth"
+//	@Param			profile		query	string	false	"Transcode profile for play, none - disable profile selected by User-Agent"
+//	@Param			start		query	string	false	"Start time of transcode, seconds or hh:mm:ss"
 //
 //	@Produce		application/octet-stream
 //	@Success		200	"Data returned according to query"
@@ -77,6 +85,11 @@ func stream(c *gin.Context) {
 		return
 	}
 
+	if save && !auth.HasRole(c, sets.RoleUploader) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
 	if link == "" {
 		c.AbortWithError(http.StatusBadRequest, errors.New("link should not be empty"))
 		return
@@ -160,7 +173,7 @@ func stream(c *gin.Context) {
 	} else
 	// return play if query
 	if play {
-		tor.Stream(index, c.Request, c.Writer)
+		streamFile(c, tor, index)
 		return
 	}
 }
@@ -186,6 +199,13 @@ func streamNoAuth(c *gin.Context) {
 		return
 	}
 
+	ind, _ := strconv.Atoi(indexStr)
+	if !sets.CheckStreamToken(spec.InfoHash.HexString(), ind, c.Query("exp"), c.Query("sig")) {
+		c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
 	tor := torr.GetTorrent(spec.InfoHash.HexString())
 	if tor == nil {
 		c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
@@ -255,7 +275,7 @@ func streamNoAuth(c *gin.Context) {
 	} else
 	// return play if query
 	if play {
-		tor.Stream(index, c.Request, c.Writer)
+		streamFile(c, tor, index)
 		return
 	}
 	c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
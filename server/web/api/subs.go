@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	sets "server/settings"
+	"server/subs"
+	"server/torr"
+	"server/torr/state"
+)
+
+// subtitles godoc
+//
+//	@Summary		Get subtitles of video file
+//	@Description	List text subtitles tracks embedded in video file and sidecar subtitles files of torrent, or get track converted to WebVTT or SRT.
+//
+//	@Tags			API
+//
+//	@Param			hash	path	string	true	"Torrent hash"
+//	@Param			id		path	string	true	"File index in torrent"
+//	@Param			track	path	string	false	"Track id with format extension: 1.vtt or 1.srt"
+//	@Param			exp		query	string	false	"Signed link expiration, unix time"
+//	@Param			sig		query	string	false	"Signed link signature, allows get subtitles without auth"
+//
+//	@Produce		json
+//	@Success		200	{array}	subs.Track	"Subtitles tracks or track file"
+//	@Success		202	"Embedded track is being extracted, retry later"
+//	@Router			/subs/{hash}/{id} [get]
+func subtitles(c *gin.Context) {
+	hash := strings.ToLower(c.Param("hash"))
+	index, err := strconv.Atoi(c.Param("id"))
+	track := strings.TrimPrefix(c.Param("track"), "/")
+	notAuth := c.GetBool("auth_required") && c.GetString(gin.AuthUserKey) == ""
+
+	if hash == "" || err != nil {
+		c.AbortWithError(http.StatusNotFound, errors.New("link should not be empty"))
+		return
+	}
+
+	if notAuth && !sets.CheckStreamToken(hash, index, c.Query("exp"), c.Query("sig")) {
+		c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	tor := torr.GetTorrent(hash)
+	if tor == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if tor.Stat == state.TorrentInDB {
+		tor = torr.LoadTorrent(tor)
+		if tor == nil {
+			c.AbortWithError(http.StatusInternalServerError, errors.New("error get torrent info"))
+			return
+		}
+	}
+
+	st := tor.Status()
+	tracks := subs.List(st.Hash, st.FileStats, index, true)
+	if track == "" {
+		c.JSON(200, tracks)
+		return
+	}
+
+	format := strings.TrimPrefix(filepath.Ext(track), ".")
+	id, err := strconv.Atoi(strings.TrimSuffix(track, filepath.Ext(track)))
+	if err != nil || id < 1 || id > len(tracks) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	buf, err := subs.Get(tor, index, tracks[id-1], format)
+	if errors.Is(err, subs.ErrPending) {
+		c.Header("Retry-After", "10")
+		c.Status(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	contentType := "text/vtt; charset=utf-8"
+	if format == "srt" {
+		contentType = "application/x-subrip; charset=utf-8"
+	}
+	c.Data(200, contentType, buf)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	sets "server/settings"
+	"server/thumbs"
+	"server/torr"
+)
+
+// thumb godoc
+//
+//	@Summary		Get thumbnail of video file
+//	@Description	Get thumbnail of video file or sprite of frames, generated by ffmpeg and cached on disk.
+//
+//	@Tags			API
+//
+//	@Param			hash	path	string	true	"Torrent hash"
+//	@Param			id		path	string	true	"File index in torrent"
+//	@Param			sprite	query	int		false	"Count of frames in sprite, 1-20"
+//	@Param			exp		query	string	false	"Signed link expiration, unix time"
+//	@Param			sig		query	string	false	"Signed link signature, allows get thumbnail without auth"
+//
+//	@Produce		image/jpeg
+//	@Success		200	"Thumbnail image"
+//	@Router			/thumb/{hash}/{id} [get]
+func thumb(c *gin.Context) {
+	hash := strings.ToLower(c.Param("hash"))
+	index, err := strconv.Atoi(c.Param("id"))
+	notAuth := c.GetBool("auth_required") && c.GetString(gin.AuthUserKey) == ""
+
+	if hash == "" || err != nil {
+		c.AbortWithError(http.StatusNotFound, errors.New("link should not be empty"))
+		return
+	}
+
+	if notAuth && !sets.CheckStreamToken(hash, index, c.Query("exp"), c.Query("sig")) {
+		c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if torr.GetTorrent(hash) == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	frames, _ := strconv.Atoi(c.Query("sprite"))
+	name, err := thumbs.Get(hash, index, frames)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Cache-Control", "max-age=86400")
+	c.File(name)
+}
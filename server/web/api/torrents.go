@@ -2,39 +2,62 @@ package api
 
 import (
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"server/dlna"
 	"server/log"
 	set "server/settings"
+	"server/thumbs"
 	"server/torr"
 	"server/torr/state"
 	"server/web/api/utils"
+	"server/web/auth"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 )
 
-// Action: add, get, set, rem, list, drop
+// Action: add, get, set, rem, list, drop, keep, tag, tags, priority
 type torrReqJS struct {
 	requestI
-	Link     string `json:"link,omitempty"`
-	Hash     string `json:"hash,omitempty"`
-	Title    string `json:"title,omitempty"`
-	Category string `json:"category,omitempty"`
-	Poster   string `json:"poster,omitempty"`
-	Data     string `json:"data,omitempty"`
-	SaveToDB bool   `json:"save_to_db,omitempty"`
+	Link     string   `json:"link,omitempty"`
+	Hash     string   `json:"hash,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Category string   `json:"category,omitempty"`
+	Poster   string   `json:"poster,omitempty"`
+	Data     string   `json:"data,omitempty"`
+	SaveToDB bool     `json:"save_to_db,omitempty"`
+	Keep     bool     `json:"keep,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Files    []int    `json:"files,omitempty"`    // file ids for priority
+	Priority string   `json:"priority,omitempty"` // skip, normal, high
+
+	// list filters, category filters by Category
+	Query     string `json:"query,omitempty"` // search in title, name and file paths
+	Tag       string `json:"tag,omitempty"`
+	MinSize   int64  `json:"min_size,omitempty"`
+	MaxSize   int64  `json:"max_size,omitempty"`
+	AddedFrom int64  `json:"added_from,omitempty"` // unix time
+	AddedTo   int64  `json:"added_to,omitempty"`   // unix time
+	Viewed    string `json:"viewed,omitempty"`     // viewed, unviewed
+	Sort      string `json:"sort,omitempty"`       // timestamp, title, size
+	Order     string `json:"order,omitempty"`      // asc, desc
+	Offset    int    `json:"offset,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
 }
 
 // torrents godoc
 //
 //	@Summary		Handle torrents informations
-//	@Description	Allow to list, add, remove, get, set, drop, wipe torrents on server. The action depends of what has been asked.
+//	@Description	Allow to list, add, remove, get, set, drop, wipe, keep, tag torrents and set priority of files on server. The action depends of what has been asked.
+//	@Description	List is filtered by query, category, tag, size, added time and viewed state, sorted and paginated, total count is returned in X-Total-Count header.
 //
 //	@Tags			API
 //
-//	@Param			request	body	torrReqJS	true	"Torrent request. Available params for action: add, get, set, rem, list, drop, wipe. link required for add, hash required for get, set, rem, drop."
+//	@Param			request	body	torrReqJS	true	"Torrent request. Available params for action: add, get, set, rem, list, drop, wipe, keep, tag, tags, priority. link required for add, hash required for get, set, rem, drop, keep, tag, priority."
 //
 //	@Accept			json
 //	@Produce		json
@@ -48,6 +71,10 @@ func torrents(c *gin.Context) {
 		return
 	}
 	c.Status(http.StatusBadRequest)
+	if !auth.HasRole(c, actionRole(req.Action)) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
 	switch req.Action {
 	case "add":
 		{
@@ -67,7 +94,7 @@ func torrents(c *gin.Context) {
 		}
 	case "list":
 		{
-			listTorrents(c)
+			listTorrents(req, c)
 		}
 	case "drop":
 		{
@@ -77,7 +104,34 @@ func torrents(c *gin.Context) {
 		{
 			wipeTorrents(c)
 		}
+	case "keep":
+		{
+			keepTorrent(req, c)
+		}
+	case "tag":
+		{
+			tagTorrent(req, c)
+		}
+	case "tags":
+		{
+			listTags(c)
+		}
+	case "priority":
+		{
+			priorityTorrent(req, c)
+		}
+	}
+}
+
+// actionRole returns minimal user role required for action
+func actionRole(action string) string {
+	switch action {
+	case "add", "set", "drop", "keep", "tag", "priority":
+		return set.RoleUploader
+	case "rem", "wipe":
+		return set.RoleAdmin
 	}
+	return set.RoleViewer
 }
 
 func addTorrent(req torrReqJS, c *gin.Context) {
@@ -168,6 +222,7 @@ func remTorrent(req torrReqJS, c *gin.Context) {
 		return
 	}
 	torr.RemTorrent(req.Hash)
+	thumbs.Remove(req.Hash)
 	// TODO: remove
 	if set.BTsets.EnableDLNA {
 		dlna.Stop()
@@ -176,19 +231,127 @@ func remTorrent(req torrReqJS, c *gin.Context) {
 	c.Status(200)
 }
 
-func listTorrents(c *gin.Context) {
+func listTorrents(req torrReqJS, c *gin.Context) {
 	list := torr.ListTorrent()
-	if len(list) == 0 {
-		c.JSON(200, []*state.TorrentStatus{})
-		return
-	}
-	var stats []*state.TorrentStatus
+	stats := make([]*state.TorrentStatus, 0, len(list))
 	for _, tr := range list {
-		stats = append(stats, tr.Status())
+		st := tr.Status()
+		if matchTorrent(req, st) {
+			stats = append(stats, st)
+		}
+	}
+
+	sortTorrents(stats, req.Sort, req.Order)
+	c.Header("X-Total-Count", strconv.Itoa(len(stats)))
+	if req.Offset > 0 {
+		stats = stats[min(req.Offset, len(stats)):]
+	}
+	if req.Limit > 0 && req.Limit < len(stats) {
+		stats = stats[:req.Limit]
 	}
 	c.JSON(200, stats)
 }
 
+// matchTorrent reports if torrent matches list filters of request
+func matchTorrent(req torrReqJS, st *state.TorrentStatus) bool {
+	if req.Category != "" && !strings.EqualFold(st.Category, req.Category) {
+		return false
+	}
+	if req.Tag != "" && !slices.ContainsFunc(st.Tags, func(tag string) bool { return strings.EqualFold(tag, req.Tag) }) {
+		return false
+	}
+	if req.MinSize > 0 && st.TorrentSize < req.MinSize || req.MaxSize > 0 && st.TorrentSize > req.MaxSize {
+		return false
+	}
+	if req.AddedFrom > 0 && st.Timestamp < req.AddedFrom || req.AddedTo > 0 && st.Timestamp > req.AddedTo {
+		return false
+	}
+	if req.Viewed != "" && (len(set.ListViewed(st.Hash)) > 0) != (req.Viewed == "viewed") {
+		return false
+	}
+	if req.Query == "" {
+		return true
+	}
+	query := strings.ToLower(req.Query)
+	if strings.Contains(strings.ToLower(st.Title), query) || strings.Contains(strings.ToLower(st.Name), query) {
+		return true
+	}
+	files := st.FileStats
+	if len(files) == 0 {
+		// files of torrent not loaded are saved in data
+		files = torr.DataFiles(st.Data)
+	}
+	for _, f := range files {
+		if strings.Contains(strings.ToLower(f.Path), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortTorrents(stats []*state.TorrentStatus, by, order string) {
+	desc := order != "asc"
+	if by == "title" && order == "" {
+		desc = false
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if desc {
+			a, b = b, a
+		}
+		switch by {
+		case "title":
+			return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+		case "size":
+			return a.TorrentSize < b.TorrentSize
+		default:
+			return a.Timestamp < b.Timestamp
+		}
+	})
+}
+
+func tagTorrent(req torrReqJS, c *gin.Context) {
+	if req.Hash == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("hash is empty"))
+		return
+	}
+	if err := torr.SetTags(req.Hash, req.Tags); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.Status(200)
+}
+
+func priorityTorrent(req torrReqJS, c *gin.Context) {
+	if req.Hash == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("hash is empty"))
+		return
+	}
+	if err := torr.SetFilePriority(req.Hash, req.Files, req.Priority); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.Status(200)
+}
+
+// listTags returns tags of all torrents sorted by name
+func listTags(c *gin.Context) {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, tr := range torr.ListTorrent() {
+		for _, tag := range tr.Tags {
+			if !seen[strings.ToLower(tag)] {
+				seen[strings.ToLower(tag)] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return strings.ToLower(tags[i]) < strings.ToLower(tags[j])
+	})
+	c.JSON(200, tags)
+}
+
 func dropTorrent(req torrReqJS, c *gin.Context) {
 	if req.Hash == "" {
 		c.AbortWithError(http.StatusBadRequest, errors.New("hash is empty"))
@@ -198,10 +361,23 @@ func dropTorrent(req torrReqJS, c *gin.Context) {
 	c.Status(200)
 }
 
+func keepTorrent(req torrReqJS, c *gin.Context) {
+	if req.Hash == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("hash is empty"))
+		return
+	}
+	if err := torr.SetKeep(req.Hash, req.Keep); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.Status(200)
+}
+
 func wipeTorrents(c *gin.Context) {
 	torrents := torr.ListTorrent()
 	for _, t := range torrents {
 		torr.RemTorrent(t.TorrentSpec.InfoHash.HexString())
+		thumbs.Remove(t.TorrentSpec.InfoHash.HexString())
 	}
 	// TODO: remove (copied todo from remTorrent())
 	if set.BTsets.EnableDLNA {
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"testing"
+
+	"server/torr/state"
+)
+
+func TestMatchTorrent(t *testing.T) {
+	st := &state.TorrentStatus{
+		Title:       "The Show Season 1",
+		Name:        "The.Show.S01.1080p",
+		Category:    "tv",
+		Tags:        []string{"Favorite"},
+		TorrentSize: 4 << 30,
+		Timestamp:   1700000000,
+		FileStats:   []*state.TorrentFileStat{{Id: 1, Path: "The.Show.S01/Pilot.mkv"}},
+	}
+	tests := []struct {
+		name string
+		req  torrReqJS
+		want bool
+	}{
+		{"no filters", torrReqJS{}, true},
+		{"category", torrReqJS{Category: "TV"}, true},
+		{"other category", torrReqJS{Category: "movie"}, false},
+		{"tag", torrReqJS{Tag: "favorite"}, true},
+		{"other tag", torrReqJS{Tag: "kids"}, false},
+		{"size in range", torrReqJS{MinSize: 1 << 30, MaxSize: 8 << 30}, true},
+		{"smaller than min", torrReqJS{MinSize: 8 << 30}, false},
+		{"bigger than max", torrReqJS{MaxSize: 1 << 30}, false},
+		{"added in range", torrReqJS{AddedFrom: 1600000000, AddedTo: 1800000000}, true},
+		{"added before", torrReqJS{AddedFrom: 1800000000}, false},
+		{"added after", torrReqJS{AddedTo: 1600000000}, false},
+		{"query title", torrReqJS{Query: "show season"}, true},
+		{"query name", torrReqJS{Query: "1080p"}, true},
+		{"query file", torrReqJS{Query: "pilot"}, true},
+		{"query not found", torrReqJS{Query: "finale"}, false},
+		{"query and wrong category", torrReqJS{Query: "pilot", Category: "movie"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchTorrent(tt.req, st); got != tt.want {
+				t.Errorf("matchTorrent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortTorrents(t *testing.T) {
+	newStats := func() []*state.TorrentStatus {
+		return []*state.TorrentStatus{
+			{Title: "b", TorrentSize: 3, Timestamp: 1},
+			{Title: "C", TorrentSize: 1, Timestamp: 3},
+			{Title: "a", TorrentSize: 2, Timestamp: 2},
+		}
+	}
+	tests := []struct {
+		by, order string
+		want      []string
+	}{
+		{"", "", []string{"C", "a", "b"}},
+		{"timestamp", "asc", []string{"b", "a", "C"}},
+		{"title", "", []string{"a", "b", "C"}},
+		{"title", "desc", []string{"C", "b", "a"}},
+		{"size", "", []string{"b", "a", "C"}},
+		{"size", "asc", []string{"C", "a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.by+"_"+tt.order, func(t *testing.T) {
+			stats := newStats()
+			sortTorrents(stats, tt.by, tt.order)
+			for i, st := range stats {
+				if st.Title != tt.want[i] {
+					t.Errorf("sortTorrents(%q, %q)[%d] = %q, want %q", tt.by, tt.order, i, st.Title, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"server/ffprobe"
+	sets "server/settings"
+	"server/subs"
+	"server/torr"
+	utils2 "server/utils"
+)
+
+// transcodeProfile returns profile from query or selected by User-Agent of player,
+// nil if file must be streamed without transcoding
+func transcodeProfile(c *gin.Context) (*sets.TranscodeProfile, error) {
+	name := c.Query("profile")
+	if name == "none" {
+		return nil, nil
+	}
+	if name != "" {
+		if p := sets.GetTranscodeProfile(name); p != nil {
+			return p, nil
+		}
+		return nil, errors.New("unknown transcode profile")
+	}
+	if !ffprobe.FFmpegExists() {
+		return nil, nil
+	}
+	return sets.SelectTranscodeProfile(c.Request.UserAgent()), nil
+}
+
+// streamFile streams file of torrent as is or transcoded by profile
+func streamFile(c *gin.Context, tor *torr.Torrent, index int) {
+	profile, err := transcodeProfile(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if profile != nil {
+		tor.Transcode(index, profile, c.Request, c.Writer)
+		return
+	}
+	// caption for Samsung and compatible DLNA renderers
+	if c.GetHeader("getCaptionInfo.sec") != "" {
+		st := tor.Status()
+		if tracks := subs.List(st.Hash, st.FileStats, index, false); len(tracks) > 0 {
+			c.Header("CaptionInfo.sec", utils2.GetScheme(c)+"://"+c.Request.Host+"/"+subs.Path(tor.Hash().HexString(), index, tracks[0].Id, "srt"))
+		}
+	}
+	tor.Stream(index, c.Request, c.Writer)
+}
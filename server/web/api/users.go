@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+
+	sets "server/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Action: list, set, rem
+type usersReqJS struct {
+	requestI
+	Name     string `json:"name,omitempty"`
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// users godoc
+//
+//	@Summary		Manage users
+//	@Description	Allow to list, add, edit or remove http auth users. Only for admin role.
+//
+//	@Tags			API
+//
+//	@Param			request	body	usersReqJS	true	"Users request. Available params for action: list, set, rem. name required for set, rem. role: viewer, uploader, admin"
+//
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}	sets.User
+//	@Router			/users [post]
+func users(c *gin.Context) {
+	var req usersReqJS
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	switch req.Action {
+	case "list":
+		{
+			listUsers(c)
+		}
+	case "set":
+		{
+			setUser(req, c)
+		}
+	case "rem":
+		{
+			remUser(req, c)
+		}
+	default:
+		c.AbortWithError(http.StatusBadRequest, errors.New("action is empty"))
+	}
+}
+
+func listUsers(c *gin.Context) {
+	list := []*sets.User{}
+	for _, user := range sets.ListUsers() {
+		list = append(list, &sets.User{Name: user.Name, Role: user.Role})
+	}
+	c.JSON(200, list)
+}
+
+func setUser(req usersReqJS, c *gin.Context) {
+	if err := sets.SetUser(req.Name, req.Password, req.Role); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.Status(200)
+}
+
+func remUser(req usersReqJS, c *gin.Context) {
+	if req.Name == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("name is empty"))
+		return
+	}
+	if req.Name == c.GetString(gin.AuthUserKey) {
+		c.AbortWithError(http.StatusBadRequest, errors.New("can't remove current user"))
+		return
+	}
+	if err := sets.RemUser(req.Name); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.Status(200)
+}
@@ -6,13 +6,14 @@ import (
 	sets "server/settings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 )
 
 /*
 file index starts from 1
 */
 
-// Action: set, rem, list
+// Action: set, rem, list, position
 type viewedReqJS struct {
 	requestI
 	*sets.Viewed
@@ -21,11 +22,11 @@ type viewedReqJS struct {
 // viewed godoc
 //
 //	@Summary		Set / List / Remove viewed torrents
-//	@Description	Allow to set, list or remove viewed torrents from server.
+//	@Description	Allow to set, list or remove viewed torrents and playback positions from server.
 //
 //	@Tags			API
 //
-//	@Param			request	body	viewedReqJS	true	"Viewed torrent request. Available params for action: set, rem, list"
+//	@Param			request	body	viewedReqJS	true	"Viewed torrent request. Available params for action: set, rem, list, position. offset (bytes) or seconds required for position"
 //
 //	@Accept			json
 //	@Produce		json
@@ -52,6 +53,10 @@ func viewed(c *gin.Context) {
 		{
 			listViewed(req, c)
 		}
+	case "position":
+		{
+			setPosition(req, c)
+		}
 	}
 }
 
@@ -60,6 +65,19 @@ func setViewed(req viewedReqJS, c *gin.Context) {
 	c.Status(200)
 }
 
+func setPosition(req viewedReqJS, c *gin.Context) {
+	if req.Viewed == nil || req.Hash == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("hash is empty"))
+		return
+	}
+	if req.Offset <= 0 && req.Seconds <= 0 {
+		c.AbortWithError(http.StatusBadRequest, errors.New("offset or seconds required"))
+		return
+	}
+	sets.SetPosition(req.Viewed)
+	c.Status(200)
+}
+
 func remViewed(req viewedReqJS, c *gin.Context) {
 	sets.RemViewed(req.Viewed)
 	c.Status(200)
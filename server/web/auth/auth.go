@@ -2,68 +2,84 @@ package auth
 
 import (
 	"encoding/base64"
-	"encoding/json"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/gin-gonic/gin"
 
-	"server/log"
 	"server/settings"
 )
 
+// RoleKey is context key of authorized user role
+const RoleKey = "auth_role"
+
 func SetupAuth(engine *gin.Engine) {
 	if !settings.HttpAuth {
 		return
 	}
-	accs := getAccounts()
-	if accs == nil {
+	if len(settings.ListUsers()) == 0 {
 		return
 	}
-	engine.Use(BasicAuth(accs))
+	engine.Use(BasicAuth())
 }
 
-func getAccounts() gin.Accounts {
-	buf, err := os.ReadFile(filepath.Join(settings.Path, "accs.db"))
-	if err != nil {
-		return nil
+// verified keeps checked Authorization headers with password hash,
+// bcrypt check is slow for every stream request
+var (
+	verified   = make(map[string]string)
+	muVerified sync.RWMutex
+)
+
+// ResetVerified clears checked Authorization headers, users could be replaced by restore of backup
+func ResetVerified() {
+	muVerified.Lock()
+	verified = make(map[string]string)
+	muVerified.Unlock()
+}
+
+func searchCredential(authValue string) (*settings.User, bool) {
+	if !strings.HasPrefix(authValue, "Basic ") {
+		return nil, false
 	}
-	var accs gin.Accounts
-	err = json.Unmarshal(buf, &accs)
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authValue, "Basic "))
 	if err != nil {
-		log.TLogln("Error parse accs.db", err)
+		return nil, false
+	}
+	name, pass, ok := strings.Cut(string(buf), ":")
+	if !ok {
+		return nil, false
+	}
+	user := settings.GetUser(name)
+	if user == nil {
+		return nil, false
 	}
-	return accs
-}
-
-type authPair struct {
-	value string
-	user  string
-}
-type authPairs []authPair
 
-func (a authPairs) searchCredential(authValue string) (string, bool) {
-	if authValue == "" {
-		return "", false
+	muVerified.RLock()
+	hash, ok := verified[authValue]
+	muVerified.RUnlock()
+	if ok && hash == user.Password {
+		return user, true
 	}
-	for _, pair := range a {
-		if pair.value == authValue {
-			return pair.user, true
-		}
+
+	if !user.CheckPassword(pass) {
+		return nil, false
 	}
-	return "", false
+	muVerified.Lock()
+	verified[authValue] = user.Password
+	muVerified.Unlock()
+	return user, true
 }
 
-func BasicAuth(accounts gin.Accounts) gin.HandlerFunc {
-	pairs := processAccounts(accounts)
+func BasicAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set("auth_required", true)
 
-		user, found := pairs.searchCredential(c.Request.Header.Get("Authorization"))
+		user, found := searchCredential(c.Request.Header.Get("Authorization"))
 		if found {
-			c.Set(gin.AuthUserKey, user)
+			c.Set(gin.AuthUserKey, user.Name)
+			c.Set(RoleKey, user.Role)
 		}
 	}
 }
@@ -83,21 +99,21 @@ func CheckAuth() gin.HandlerFunc {
 	}
 }
 
-func processAccounts(accounts gin.Accounts) authPairs {
-	pairs := make(authPairs, 0, len(accounts))
-	for user, password := range accounts {
-		value := authorizationHeader(user, password)
-		pairs = append(pairs, authPair{
-			value: value,
-			user:  user,
-		})
+// HasRole reports whether authorized user has role or higher, always true without http auth
+func HasRole(c *gin.Context, role string) bool {
+	if !settings.HttpAuth {
+		return true
 	}
-	return pairs
+	return settings.RoleLevel(c.GetString(RoleKey)) >= settings.RoleLevel(role)
 }
 
-func authorizationHeader(user, password string) string {
-	base := user + ":" + password
-	return "Basic " + base64.StdEncoding.EncodeToString(StringToBytes(base))
+// CheckRole must be used after CheckAuth
+func CheckRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasRole(c, role) {
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	}
 }
 
 func StringToBytes(s string) (b []byte) {
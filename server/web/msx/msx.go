@@ -9,7 +9,10 @@ import (
 	"strconv"
 	"strings"
 
+	"server/ffprobe"
 	"server/settings"
+	"server/subs"
+	"server/thumbs"
 	"server/torr"
 	"server/utils"
 	"server/version"
@@ -66,7 +69,7 @@ func SetupRoute(r gin.IRouter) {
 			},
 		})
 	})
-	authorized.POST("/msx/start.json", func(c *gin.Context) {
+	authorized.POST("/msx/start.json", auth.CheckRole(settings.RoleAdmin), func(c *gin.Context) {
 		if e := c.BindJSON(&param); e != nil {
 			c.AbortWithError(http.StatusBadRequest, e)
 		}
@@ -116,6 +119,81 @@ func SetupRoute(r gin.IRouter) {
 		r.R.T = http.StatusText(r.R.S)
 		c.JSON(http.StatusOK, &r)
 	})
+	authorized.GET("/msx/pos", func(c *gin.Context) {
+		var r struct {
+			R struct {
+				S int            `json:"status"`
+				T string         `json:"text"`
+				M string         `json:"message,omitempty"`
+				D map[string]any `json:"data,omitempty"`
+			} `json:"response"`
+		}
+		if i, e := strconv.Atoi(c.Query("id")); e != nil || c.Query("hash") == "" {
+			r.R.S, r.R.M = http.StatusBadRequest, "hash or id is not set"
+		} else if p := settings.GetPosition(c.Query("hash"), i); p == nil || p.Seconds <= 0 {
+			r.R.S, r.R.M = http.StatusNotFound, "position is not saved"
+		} else {
+			r.R.S, r.R.D = http.StatusOK, map[string]any{"action": "player:goto:" + strconv.FormatInt(int64(p.Seconds), 10), "position": p}
+		}
+		r.R.T = http.StatusText(r.R.S)
+		c.JSON(http.StatusOK, &r)
+	})
+	authorized.GET("/msx/link", func(c *gin.Context) {
+		var r struct {
+			R struct {
+				S int            `json:"status"`
+				T string         `json:"text"`
+				M string         `json:"message,omitempty"`
+				D map[string]any `json:"data,omitempty"`
+			} `json:"response"`
+		}
+		if i, e := strconv.Atoi(c.Query("id")); e != nil || c.Query("hash") == "" {
+			r.R.S, r.R.M = http.StatusBadRequest, "hash or id is not set"
+		} else {
+			h := utils.GetScheme(c) + "://" + c.Request.Host
+			l := h + "/play/" + c.Query("hash") + "/" + strconv.Itoa(i)
+			if settings.HttpAuth {
+				l += "?" + settings.StreamToken(c.Query("hash"), i)
+			}
+			s := make([]map[string]any, 0)
+			if t := torr.GetTorrent(c.Query("hash")); t != nil {
+				st := t.Status()
+				for _, v := range subs.List(st.Hash, st.FileStats, i, false) {
+					s = append(s, map[string]any{"label": v.Label(), "language": v.Language, "link": h + "/" + subs.Path(c.Query("hash"), i, v.Id, "vtt")})
+				}
+			}
+			r.R.S, r.R.D = http.StatusOK, map[string]any{"action": "video:" + l, "link": l, "subtitles": s}
+			if ffprobe.FFmpegExists() {
+				r.R.D["image"] = h + "/" + thumbs.Path(c.Query("hash"), i)
+			}
+		}
+		r.R.T = http.StatusText(r.R.S)
+		c.JSON(http.StatusOK, &r)
+	})
+	authorized.GET("/msx/seasons", func(c *gin.Context) {
+		var r struct {
+			R struct {
+				S int            `json:"status"`
+				T string         `json:"text"`
+				M string         `json:"message,omitempty"`
+				D map[string]any `json:"data,omitempty"`
+			} `json:"response"`
+		}
+		if c.Query("hash") == "" {
+			r.R.S, r.R.M = http.StatusBadRequest, "hash is not set"
+		} else if t := torr.GetTorrent(c.Query("hash")); t == nil {
+			r.R.S, r.R.M = http.StatusNotFound, "torrent not found"
+		} else {
+			f := utils.SortEpisodes(t.Status().FileStats)
+			s := make([]map[string]any, 0)
+			for _, n := range utils.Seasons(f) {
+				s = append(s, map[string]any{"season": n, "title": "Season " + strconv.Itoa(n), "files": utils.SeasonFiles(f, n)})
+			}
+			r.R.S, r.R.D = http.StatusOK, map[string]any{"seasons": s, "files": f}
+		}
+		r.R.T = http.StatusText(r.R.S)
+		c.JSON(http.StatusOK, &r)
+	})
 	authorized.Any("/msx/proxy", func(c *gin.Context) {
 		if u := c.Query("url"); u == "" {
 			c.AbortWithStatus(http.StatusBadRequest)
@@ -160,7 +238,7 @@ func SetupRoute(r gin.IRouter) {
 			c.JSON(http.StatusInternalServerError, e.Error)
 		}
 	})
-	authorized.POST("/files", func(c *gin.Context) {
+	authorized.POST("/files", auth.CheckRole(settings.RoleAdmin), func(c *gin.Context) {
 		var l string
 		if e := c.BindJSON(&l); e != nil {
 			c.AbortWithError(http.StatusBadRequest, e)
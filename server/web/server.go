@@ -69,6 +69,7 @@ func Start() {
 	corsCfg.AllowAllOrigins = true
 	corsCfg.AllowPrivateNetwork = true
 	corsCfg.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "X-Requested-With", "Accept", "Authorization"}
+	corsCfg.ExposeHeaders = []string{"X-Total-Count"}
 
 	route := gin.New()
 	route.Use(log.WebLogger(), blocker.Blocker(), gin.Recovery(), cors.New(corsCfg), location.Default())